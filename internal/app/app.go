@@ -13,17 +13,28 @@ import (
 	"github.com/sanchey92/jwt-example/internal/config"
 	"github.com/sanchey92/jwt-example/internal/handlers"
 	"github.com/sanchey92/jwt-example/internal/logger"
+	"github.com/sanchey92/jwt-example/internal/mail"
 	"github.com/sanchey92/jwt-example/internal/middleware"
+	"github.com/sanchey92/jwt-example/internal/models"
 	"github.com/sanchey92/jwt-example/internal/service"
+	"github.com/sanchey92/jwt-example/internal/storage/memory"
 	"github.com/sanchey92/jwt-example/internal/storage/pg"
 	"github.com/sanchey92/jwt-example/pkg/closer"
+	"github.com/sanchey92/jwt-example/pkg/password"
+	"github.com/sanchey92/jwt-example/pkg/utils"
 )
 
 type App struct {
 	config      *config.Config
 	storage     *pg.Storage
+	keys        *utils.KeyRing
+	revocations service.RevocationStore
+	hasher      service.PasswordHasher
+	policy      *password.Policy
+	mailer      mail.Sender
 	authService *service.AuthService
 	authHandler *handlers.AuthHandler
+	jwksHandler *handlers.JWKSHandler
 	httpServer  *http.Server
 }
 
@@ -70,8 +81,14 @@ func (a *App) initDeps(ctx context.Context) error {
 		a.initConfig,
 		a.initLogger,
 		a.initStorage,
+		a.initKeys,
+		a.initRevocationStore,
+		a.initMailer,
+		a.initPasswordHasher,
+		a.initPasswordPolicy,
 		a.initAuthService,
 		a.initAuthHandler,
+		a.initJWKSHandler,
 		//...
 		a.initHTTPServer,
 	}
@@ -105,8 +122,168 @@ func (a *App) initStorage(ctx context.Context) error {
 	return nil
 }
 
+func (a *App) initKeys(ctx context.Context) error {
+	var (
+		key *utils.Key
+		err error
+	)
+
+	if a.config.JWTSigningAlg == utils.AlgHS256 {
+		key = utils.NewHMACKey(a.config.JWTAccessSecret)
+	} else if key, err = utils.LoadPrivateKey(a.config.JWTSigningAlg, a.config.JWTPrivateKeyPath); err != nil {
+		return err
+	}
+
+	a.keys = utils.NewKeyRing(key)
+
+	grace := time.Duration(a.config.KeyGracePeriod) * time.Minute
+
+	if a.config.JWTPreviousAccessSecret != "" {
+		a.keys.AddRetiring(utils.NewHMACKey(a.config.JWTPreviousAccessSecret), time.Now().Add(grace))
+	}
+
+	if a.config.JWTPreviousPublicKeyPath != "" {
+		previous, err := utils.LoadPublicKey(a.config.JWTSigningAlg, a.config.JWTPreviousPublicKeyPath)
+		if err != nil {
+			return err
+		}
+		a.keys.AddRetiring(previous, time.Now().Add(grace))
+	}
+
+	if a.config.KeyRotationInterval == 0 {
+		return nil
+	}
+
+	return a.startKeyRotation(ctx, &utils.KeyRotation{
+		Ring:      a.keys,
+		Store:     a.storage,
+		Algorithm: a.config.JWTSigningAlg,
+		Secret:    a.config.JWTRefreshSecret,
+		Interval:  time.Duration(a.config.KeyRotationInterval) * time.Hour,
+		Delay:     a.jwksMaxAge() + keySyncInterval,
+		Grace:     grace,
+	})
+}
+
+// keySyncInterval is how often instances load the signing keys scheduled by any of them.
+const keySyncInterval = time.Minute
+
+// startKeyRotation loads the stored signing keys and keeps syncing them. Rotated keys are kept in
+// Postgres, so every instance signs with the same key and tokens survive restarts.
+func (a *App) startKeyRotation(ctx context.Context, rotation *utils.KeyRotation) error {
+	if err := rotation.Sync(ctx, time.Now()); err != nil {
+		return err
+	}
+
+	log := logger.GetLogger()
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(keySyncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if err := rotation.Sync(context.Background(), now); err != nil {
+					log.Error("failed to sync signing keys", zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	closer.Add(func() error {
+		close(done)
+		return nil
+	})
+
+	return nil
+}
+
+func (a *App) initRevocationStore(_ context.Context) error {
+	if a.config.RevocationStore == "memory" {
+		a.revocations = memory.NewRevocationStore()
+		return nil
+	}
+
+	a.revocations = a.storage
+	return nil
+}
+
+func (a *App) initMailer(_ context.Context) error {
+	if a.config.MailSender == "stdout" {
+		a.mailer = mail.NewStdoutSender()
+		return nil
+	}
+
+	sender, closeFn, err := mail.NewFileSender(a.config.MailFilePath)
+	if err != nil {
+		return err
+	}
+
+	a.mailer = sender
+	closer.Add(closeFn)
+	return nil
+}
+
+func (a *App) initPasswordHasher(_ context.Context) error {
+	if a.config.PasswordHasher == "bcrypt" {
+		a.hasher = password.NewBcrypt(a.config.BcryptCost)
+		return nil
+	}
+
+	a.hasher = password.NewArgon2id(password.Argon2Params{
+		Memory:      uint32(a.config.Argon2Memory),
+		Iterations:  uint32(a.config.Argon2Iterations),
+		Parallelism: uint8(a.config.Argon2Parallelism),
+	})
+	return nil
+}
+
+func (a *App) initPasswordPolicy(_ context.Context) error {
+	a.policy = &password.Policy{
+		MinLength:     a.config.PasswordMinLength,
+		MaxLength:     a.config.PasswordMaxLength,
+		RequireUpper:  a.config.PasswordRequireUpper,
+		RequireLower:  a.config.PasswordRequireLower,
+		RequireDigit:  a.config.PasswordRequireDigit,
+		RequireSymbol: a.config.PasswordRequireSymbol,
+		DisallowEmail: a.config.PasswordDisallowEmail,
+	}
+
+	if a.config.PasswordHasher == "bcrypt" {
+		a.policy.MaxBytes = password.BcryptMaxBytes
+	}
+
+	if a.config.BreachedPasswordsPath == "" {
+		return nil
+	}
+
+	breached, err := password.LoadBreachedList(a.config.BreachedPasswordsPath)
+	if err != nil {
+		return err
+	}
+
+	a.policy.Breached = breached
+	return nil
+}
+
 func (a *App) initAuthService(_ context.Context) error {
-	a.authService = service.NewAuthService(a.storage, a.storage, a.config)
+	a.authService = service.NewAuthService(
+		a.storage,
+		a.storage,
+		a.storage,
+		a.storage,
+		a.revocations,
+		a.storage,
+		a.hasher,
+		a.policy,
+		a.keys,
+		a.mailer,
+		a.config,
+	)
 	return nil
 }
 
@@ -115,18 +292,115 @@ func (a *App) initAuthHandler(_ context.Context) error {
 	return nil
 }
 
+func (a *App) initJWKSHandler(_ context.Context) error {
+	a.jwksHandler = handlers.NewJWKSHandler(a.keys, a.jwksMaxAge())
+	return nil
+}
+
+// jwksMaxAge is how long consumers may cache the JWKS, short enough to pick up a scheduled key
+// well before it signs.
+func (a *App) jwksMaxAge() time.Duration {
+	maxAge := time.Duration(a.config.KeyGracePeriod) * time.Minute / 4
+	if maxAge > 5*time.Minute {
+		maxAge = 5 * time.Minute
+	}
+
+	return maxAge
+}
+
 func (a *App) initHTTPServer(_ context.Context) error {
 	r := chi.NewRouter()
 
 	r.Use(middleware.LoggingMiddleware())
 
+	r.Get("/.well-known/jwks.json", a.jwksHandler.JWKS)
+	r.Get("/.well-known/openid-configuration", a.authHandler.OpenIDConfiguration)
+
 	r.Post("/register", a.authHandler.Register)
 	r.Post("/login", a.authHandler.Login)
+	r.Post("/login/mfa", a.authHandler.VerifyMFA)
 	r.Post("/logout", a.authHandler.Logout)
+	r.Post("/refresh", a.authHandler.Refresh)
+	if a.authService.PasswordResetEnabled() {
+		r.Post("/password/forgot", a.authHandler.ForgotPassword)
+	}
+	r.Post("/password/reset", a.authHandler.ResetPassword)
+	r.Get("/verify-email", a.authHandler.VerifyEmail)
+	r.Post("/verify-email/resend", a.authHandler.ResendVerification)
+	r.Post("/oauth/token", a.authHandler.Token)
+	r.With(middleware.AuthenticateClient(a.authService)).Get("/oauth/client", a.authHandler.CurrentClient)
 
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.Authenticate(a.authService, a.config))
-		r.Get("/profile", a.authHandler.Profile)
+		r.Use(middleware.Authenticate(a.authService))
+		r.With(middleware.RequireScope(models.ScopeProfile)).Get("/profile", a.authHandler.Profile)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireScope(models.ScopeOpenID))
+			r.Get("/userinfo", a.authHandler.UserInfo)
+			r.Post("/userinfo", a.authHandler.UserInfo)
+		})
+
+		// Tokens issued to OAuth clients only reach the routes above.
+		r.Use(middleware.RequireFirstParty())
+		if a.authService.AuthorizationEnabled() {
+			r.Get("/oauth/authorize", a.authHandler.Authorize)
+			r.Post("/oauth/authorize", a.authHandler.ApproveAuthorization)
+		}
+		r.Post("/logout/all", a.authHandler.LogoutAll)
+		r.Post("/logout/others", a.authHandler.LogoutOthers)
+		r.Post("/password/change", a.authHandler.ChangePassword)
+		r.Get("/sessions", a.authHandler.ListSessions)
+		r.Delete("/sessions/{id}", a.authHandler.DeleteSession)
+		r.Post("/mfa/enroll", a.authHandler.EnrollMFA)
+		r.Post("/mfa/confirm", a.authHandler.ConfirmMFA)
+
+		r.Route("/admin", func(r chi.Router) {
+			r.With(middleware.RequirePermission(models.PermissionUsersUnlock)).
+				Post("/users/{id}/unlock", a.authHandler.UnlockUser)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(models.PermissionUsersRead))
+				r.Get("/users", a.authHandler.ListUsers)
+				r.Get("/users/{id}", a.authHandler.GetUser)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(models.PermissionUsersWrite))
+				r.Post("/users/{id}/suspend", a.authHandler.SuspendUser)
+				r.Post("/users/{id}/activate", a.authHandler.ActivateUser)
+				r.Post("/users/{id}/logout", a.authHandler.ForceLogout)
+				r.Delete("/users/{id}", a.authHandler.DeleteUser)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(models.PermissionRolesRead))
+				r.Get("/roles", a.authHandler.ListRoles)
+				r.Get("/permissions", a.authHandler.ListPermissions)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(models.PermissionRolesWrite))
+				r.Post("/roles", a.authHandler.CreateRole)
+				r.Put("/roles/{name}/permissions", a.authHandler.SetRolePermissions)
+				r.Delete("/roles/{name}", a.authHandler.DeleteRole)
+				r.Put("/users/{id}/roles", a.authHandler.SetUserRoles)
+				r.Post("/users/{id}/roles", a.authHandler.AssignRole)
+				r.Delete("/users/{id}/roles/{role}", a.authHandler.RevokeRole)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(models.PermissionClientsRead))
+				r.Get("/clients", a.authHandler.ListOAuthClients)
+				r.Get("/clients/{id}", a.authHandler.GetOAuthClient)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(models.PermissionClientsWrite))
+				r.Post("/clients", a.authHandler.CreateOAuthClient)
+				r.Post("/clients/{id}/secret", a.authHandler.RotateOAuthClientSecret)
+				r.Delete("/clients/{id}", a.authHandler.DeleteOAuthClient)
+			})
+		})
 	})
 
 	a.httpServer = &http.Server{
@@ -2,35 +2,200 @@ package config
 
 import (
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Port             string
-	PgDSN            string
-	JWTAccessSecret  string
-	JWTRefreshSecret string
-	AccessTokenTTL   int // minute
-	RefreshTokenTTL  int // days
+	Port                     string
+	PgDSN                    string
+	JWTAccessSecret          string
+	JWTRefreshSecret         string
+	JWTSigningAlg            string // HS256, RS256, ES256 or EdDSA
+	JWTPrivateKeyPath        string // PEM file, required for asymmetric algorithms
+	JWTPreviousAccessSecret  string // HS256 secret still accepted during the grace period
+	JWTPreviousPublicKeyPath string // PEM file still accepted during the grace period
+	JWTIssuer                string // iss claim of issued tokens, also required on parse
+	JWTAudience              string // aud claim of issued tokens, also required on parse
+	JWTLeeway                int    // seconds of allowed clock skew
+	KeyRotationInterval      int    // hours, 0 disables scheduled rotation
+	KeyGracePeriod           int    // minutes
+	RevocationStore          string // memory or postgres
+	AppBaseURL               string // public URL used in links sent by email
+	MailSender               string // stdout or file
+	MailFilePath             string // used by the file mail sender
+	PasswordResetURL         string // page of the client app taking the emailed token, empty turns /password/forgot off
+	PasswordResetTTL         int    // minutes
+	EmailVerificationTTL     int    // hours
+	RequireEmailVerification bool   // refuse login until the email is verified
+	MFAIssuer                string // issuer shown by authenticator apps
+	OAuthCodeTTL             int    // seconds an OAuth authorization code stays valid
+	OAuthAuthorizationURL    string // consent page of the client app, empty turns the authorization code flow off
+	LoginMaxFailures         int    // failed logins per account before lockout, 0 disables
+	LoginMaxIPFailures       int    // failed logins per client IP before lockout, 0 disables
+	MFAMaxFailures           int    // wrong two-factor codes per user before lockout, 0 disables
+	LoginLockoutBase         int    // seconds, first lockout, doubled by every further failure
+	LoginLockoutMax          int    // minutes, longest lockout, failures older than this are forgotten
+	PasswordHasher           string // argon2id or bcrypt
+	BcryptCost               int    // used when PasswordHasher is bcrypt
+	Argon2Memory             int    // KiB
+	Argon2Iterations         int    // passes over the memory
+	Argon2Parallelism        int    // threads
+	PasswordMinLength        int    // characters
+	PasswordMaxLength        int    // characters, 0 disables
+	PasswordRequireUpper     bool
+	PasswordRequireLower     bool
+	PasswordRequireDigit     bool
+	PasswordRequireSymbol    bool
+	PasswordDisallowEmail    bool   // reject passwords containing the email or its local part
+	BreachedPasswordsPath    string // HIBP style range directory or hash file, empty disables the check
+	AccessTokenTTL           int    // minute
+	RefreshTokenTTL          int    // days
+	RefreshTokenReuseGrace   int    // seconds a rotated refresh token still refreshes, for parallel requests
 }
 
 func MustLoadConfig() *Config {
 	_ = godotenv.Load()
 
 	cfg := &Config{
-		Port:             os.Getenv("PORT"),
-		PgDSN:            os.Getenv("PG_DSN"),
-		JWTAccessSecret:  os.Getenv("JWT_ACCESS_SECRET"),
-		JWTRefreshSecret: os.Getenv("JWT_REFRESH_SECRET"),
+		Port:                     os.Getenv("PORT"),
+		PgDSN:                    os.Getenv("PG_DSN"),
+		JWTAccessSecret:          os.Getenv("JWT_ACCESS_SECRET"),
+		JWTRefreshSecret:         os.Getenv("JWT_REFRESH_SECRET"),
+		JWTSigningAlg:            getEnv("JWT_SIGNING_ALG", "HS256"),
+		JWTPrivateKeyPath:        os.Getenv("JWT_PRIVATE_KEY_PATH"),
+		JWTPreviousAccessSecret:  os.Getenv("JWT_PREVIOUS_ACCESS_SECRET"),
+		JWTPreviousPublicKeyPath: os.Getenv("JWT_PREVIOUS_PUBLIC_KEY_PATH"),
+		JWTIssuer:                getEnv("JWT_ISSUER", "jwt-example"),
+		JWTAudience:              getEnv("JWT_AUDIENCE", "jwt-example"),
+		RevocationStore:          getEnv("REVOCATION_STORE", "postgres"),
+		MailSender:               getEnv("MAIL_SENDER", "stdout"),
+		MailFilePath:             getEnv("MAIL_FILE_PATH", "logs/mail.log"),
+		PasswordResetURL:         os.Getenv("PASSWORD_RESET_URL"),
+		MFAIssuer:                getEnv("MFA_ISSUER", "jwt-example"),
+		PasswordHasher:           getEnv("PASSWORD_HASHER", "argon2id"),
+		BreachedPasswordsPath:    os.Getenv("BREACHED_PASSWORDS_PATH"),
 	}
 
-	if cfg.Port == "" || cfg.PgDSN == "" || cfg.JWTAccessSecret == "" || cfg.JWTRefreshSecret == "" {
+	if cfg.Port == "" || cfg.PgDSN == "" || cfg.JWTRefreshSecret == "" {
 		panic("Failed to get env variables")
 	}
 
+	if cfg.JWTSigningAlg == "HS256" && cfg.JWTAccessSecret == "" {
+		panic("JWT_ACCESS_SECRET is required for HS256 signing")
+	}
+
+	if cfg.JWTSigningAlg != "HS256" && cfg.JWTPrivateKeyPath == "" {
+		panic("JWT_PRIVATE_KEY_PATH is required for asymmetric signing")
+	}
+
+	if cfg.RevocationStore != "memory" && cfg.RevocationStore != "postgres" {
+		panic("REVOCATION_STORE must be memory or postgres")
+	}
+
+	if cfg.PasswordHasher != "argon2id" && cfg.PasswordHasher != "bcrypt" {
+		panic("PASSWORD_HASHER must be argon2id or bcrypt")
+	}
+
+	if cfg.MailSender != "stdout" && cfg.MailSender != "file" {
+		panic("MAIL_SENDER must be stdout or file")
+	}
+
+	cfg.AppBaseURL = getEnv("APP_BASE_URL", "http://localhost:"+cfg.Port)
+
 	cfg.AccessTokenTTL = 15 // 15 minutes
 	cfg.RefreshTokenTTL = 7 // 7 days
 
+	cfg.RefreshTokenReuseGrace = mustGetInt("REFRESH_TOKEN_REUSE_GRACE", 30)
+
+	cfg.JWTLeeway = mustGetInt("JWT_LEEWAY", 30)
+	cfg.KeyRotationInterval = mustGetInt("JWT_KEY_ROTATION_INTERVAL", 0)
+	cfg.KeyGracePeriod = mustGetInt("JWT_KEY_GRACE_PERIOD", 2*cfg.AccessTokenTTL)
+
+	if cfg.KeyGracePeriod < cfg.AccessTokenTTL {
+		panic("JWT_KEY_GRACE_PERIOD must not be shorter than the access token TTL")
+	}
+
+	cfg.PasswordResetTTL = mustGetInt("PASSWORD_RESET_TTL", 30)
+	cfg.EmailVerificationTTL = mustGetInt("EMAIL_VERIFICATION_TTL", 24)
+	cfg.RequireEmailVerification = mustGetBool("REQUIRE_EMAIL_VERIFICATION", false)
+	cfg.OAuthCodeTTL = mustGetInt("OAUTH_CODE_TTL", 60)
+	cfg.OAuthAuthorizationURL = os.Getenv("OAUTH_AUTHORIZATION_URL")
+
+	cfg.LoginMaxFailures = mustGetInt("LOGIN_MAX_FAILURES", 5)
+	cfg.LoginMaxIPFailures = mustGetInt("LOGIN_MAX_IP_FAILURES", 20)
+	cfg.MFAMaxFailures = mustGetInt("MFA_MAX_FAILURES", 5)
+	cfg.LoginLockoutBase = mustGetInt("LOGIN_LOCKOUT_BASE", 30)
+	cfg.LoginLockoutMax = mustGetInt("LOGIN_LOCKOUT_MAX", 60)
+
+	if cfg.LoginLockoutBase == 0 || cfg.LoginLockoutMax == 0 {
+		panic("LOGIN_LOCKOUT_BASE and LOGIN_LOCKOUT_MAX must be positive")
+	}
+
+	cfg.BcryptCost = mustGetInt("BCRYPT_COST", 10)
+	cfg.Argon2Memory = mustGetInt("ARGON2_MEMORY", 64*1024)
+	cfg.Argon2Iterations = mustGetInt("ARGON2_ITERATIONS", 3)
+	cfg.Argon2Parallelism = mustGetInt("ARGON2_PARALLELISM", 4)
+
+	if cfg.BcryptCost < 4 || cfg.BcryptCost > 31 {
+		panic("BCRYPT_COST must be between 4 and 31")
+	}
+
+	if cfg.Argon2Memory == 0 || cfg.Argon2Iterations == 0 || cfg.Argon2Parallelism == 0 {
+		panic("ARGON2_MEMORY, ARGON2_ITERATIONS and ARGON2_PARALLELISM must be positive")
+	}
+
+	if cfg.Argon2Parallelism > 255 {
+		panic("ARGON2_PARALLELISM must not exceed 255")
+	}
+
+	cfg.PasswordMinLength = mustGetInt("PASSWORD_MIN_LENGTH", 8)
+	cfg.PasswordMaxLength = mustGetInt("PASSWORD_MAX_LENGTH", 128)
+	cfg.PasswordRequireUpper = mustGetBool("PASSWORD_REQUIRE_UPPER", false)
+	cfg.PasswordRequireLower = mustGetBool("PASSWORD_REQUIRE_LOWER", false)
+	cfg.PasswordRequireDigit = mustGetBool("PASSWORD_REQUIRE_DIGIT", false)
+	cfg.PasswordRequireSymbol = mustGetBool("PASSWORD_REQUIRE_SYMBOL", false)
+	cfg.PasswordDisallowEmail = mustGetBool("PASSWORD_DISALLOW_EMAIL", true)
+
+	if cfg.PasswordMaxLength > 0 && cfg.PasswordMaxLength < cfg.PasswordMinLength {
+		panic("PASSWORD_MAX_LENGTH must not be shorter than PASSWORD_MIN_LENGTH")
+	}
+
 	return cfg
 }
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func mustGetInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		panic("Invalid value of " + key)
+	}
+
+	return n
+}
+
+func mustGetBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		panic("Invalid value of " + key)
+	}
+
+	return b
+}
@@ -3,11 +3,13 @@ package appError
 import (
 	"errors"
 	"net/http"
+	"time"
 )
 
 var (
 	ErrMissingEnvVars = errors.New("missing required environment variables")
 	ErrInvalidInput   = errors.New("invalid input data")
+	ErrValidation     = errors.New("validation failed")
 	ErrInternalServer = errors.New("internal server error")
 	ErrUnauthorized   = errors.New("unauthorized")
 	ErrForbidden      = errors.New("forbidden")
@@ -16,16 +18,49 @@ var (
 var (
 	ErrUserNotFound         = errors.New("user not found")
 	ErrUserAlreadyExists    = errors.New("user already exists")
-	ErrInvalidPassword      = errors.New("invalid password")
+	ErrInvalidCredentials   = errors.New("invalid email or password")
 	ErrInvalidToken         = errors.New("invalid token")
 	ErrTokenExpired         = errors.New("token expired")
+	ErrTokenReused          = errors.New("refresh token reuse detected")
+	ErrTokenRevoked         = errors.New("token revoked")
+	ErrUnknownSession       = errors.New("token is not bound to a session")
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrEmailNotVerified     = errors.New("email is not verified")
+	ErrMFAAlreadyEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled       = errors.New("two-factor authentication is not enrolled")
+	ErrInvalidMFACode       = errors.New("invalid two-factor code")
+	ErrMFACodeReused        = errors.New("two-factor code was already used")
+	ErrAccountLocked        = errors.New("account is temporarily locked")
+	ErrTooManyAttempts      = errors.New("too many failed login attempts")
+	ErrAccountSuspended     = errors.New("account is suspended")
+	ErrAccountPending       = errors.New("account is pending activation")
+	ErrAccountDeleted       = errors.New("account is deleted")
+	ErrOwnAccount           = errors.New("admins cannot suspend or delete their own account")
+	ErrRoleNotFound         = errors.New("role not found")
+	ErrRoleAlreadyExists    = errors.New("role already exists")
+	ErrRoleNotAssigned      = errors.New("user does not have the role")
+	ErrBuiltinRole          = errors.New("built-in roles cannot be deleted")
+	ErrUnknownPermission    = errors.New("unknown permission")
+	ErrOAuthClientNotFound  = errors.New("oauth client not found")
+	ErrPublicClient         = errors.New("public clients have no secret")
+	ErrClientToken          = errors.New("token was issued to a client, not to a user")
+	ErrNotClientToken       = errors.New("token was not issued to a client")
 	ErrInvalidTokenLength   = errors.New("token length must be positive")
 	ErrFailedRandGeneration = errors.New("failed to generate random byte")
+	ErrUnsupportedAlg       = errors.New("unsupported signing algorithm")
+	ErrInvalidSigningKey    = errors.New("signing key does not match algorithm")
+	ErrMissingSigningKey    = errors.New("key can only verify tokens")
+	ErrUnknownKeyID         = errors.New("unknown signing key id")
 )
 
 type ApiError struct {
 	StatusCode int
 	Message    string
+	Code       string              // machine-readable reason sent as "code", set by WithCode
+	Location   string              // where the client should be sent, used by the OAuth authorization endpoint
+	RetryAfter time.Duration       // sent as the Retry-After header when positive
+	Fields     map[string][]string // problems per input field, set by ValidationFailed
+	Err        error               // cause of a server error, logged but never sent to the client
 }
 
 func NewApiError(statusCode int, err error) *ApiError {
@@ -35,10 +70,24 @@ func NewApiError(statusCode int, err error) *ApiError {
 	}
 }
 
+// Error includes the cause, so logging the error records what Message hides from the client.
 func (e *ApiError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
 	return e.Message
 }
 
+func (e *ApiError) Unwrap() error {
+	return e.Err
+}
+
+// WithCode sets a stable code clients can branch on instead of parsing Message.
+func (e *ApiError) WithCode(code string) *ApiError {
+	e.Code = code
+	return e
+}
+
 func BadRequest(err error) *ApiError {
 	return NewApiError(http.StatusBadRequest, err)
 }
@@ -51,6 +100,46 @@ func Forbidden(err error) *ApiError {
 	return NewApiError(http.StatusForbidden, err)
 }
 
+func NotFound(err error) *ApiError {
+	return NewApiError(http.StatusNotFound, err)
+}
+
+func Conflict(err error) *ApiError {
+	return NewApiError(http.StatusConflict, err)
+}
+
+// ValidationFailed reports input that was well-formed but broke the rules for the named fields.
+func ValidationFailed(fields map[string][]string) *ApiError {
+	apiErr := BadRequest(ErrValidation)
+	apiErr.Fields = fields
+	return apiErr
+}
+
+// Locked reports a temporarily locked account, distinct from 401 so clients can tell it from a wrong password.
+func Locked(err error, retryAfter time.Duration) *ApiError {
+	apiErr := NewApiError(http.StatusLocked, err)
+	apiErr.RetryAfter = retryAfter
+	return apiErr
+}
+
+func TooManyRequests(err error, retryAfter time.Duration) *ApiError {
+	apiErr := NewApiError(http.StatusTooManyRequests, err)
+	apiErr.RetryAfter = retryAfter
+	return apiErr
+}
+
+// OAuthError reports an error of the OAuth 2.0 endpoints. code is the error code of RFC 6749,
+// description the human-readable error_description.
+func OAuthError(statusCode int, code, description string) *ApiError {
+	return &ApiError{StatusCode: statusCode, Message: description, Code: code}
+}
+
+// InternalServer answers with the generic ErrInternalServer message, driver and library errors
+// describe the schema and internals. err is kept as the cause for the log.
 func InternalServer(err error) *ApiError {
-	return NewApiError(http.StatusInternalServerError, err)
+	apiErr := NewApiError(http.StatusInternalServerError, ErrInternalServer)
+	if !errors.Is(err, ErrInternalServer) {
+		apiErr.Err = err
+	}
+	return apiErr
 }
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+)
+
+type SuspendUserInput struct {
+	Reason string `json:"reason" validate:"required,max=256"`
+}
+
+type UserRolesInput struct {
+	Roles []models.Role `json:"roles" validate:"required,dive,required,max=64"`
+}
+
+// ListUsers returns a page of users. Query parameters: email (part of the address), status, limit and offset.
+func (h *AuthHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	filter := models.UserFilter{
+		Email:  r.URL.Query().Get("email"),
+		Status: models.UserStatus(r.URL.Query().Get("status")),
+	}
+
+	var err error
+	if filter.Limit, err = queryInt(r, "limit"); err != nil {
+		h.writeError(w, appError.ValidationFailed(map[string][]string{"limit": {"must be a number"}}))
+		return
+	}
+
+	if filter.Offset, err = queryInt(r, "offset"); err != nil || filter.Offset < 0 {
+		h.writeError(w, appError.ValidationFailed(map[string][]string{"offset": {"must be a non-negative number"}}))
+		return
+	}
+
+	page, err := h.service.ListUsers(r.Context(), filter)
+	if err != nil {
+		h.log.Error("List users error", zap.Error(err))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (h *AuthHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, appError.BadRequest(appError.ErrInvalidInput))
+		return
+	}
+
+	user, err := h.service.GetUser(r.Context(), userID)
+	if err != nil {
+		h.log.Error("Get user error", zap.Error(err), zap.String("user_id", userID.String()))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// SetUserRoles replaces the roles of the user with the roles from the body.
+func (h *AuthHandler) SetUserRoles(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value("user").(*models.User)
+	if !ok || admin == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, appError.BadRequest(appError.ErrInvalidInput))
+		return
+	}
+
+	var input UserRolesInput
+
+	if err = h.decodeJSON(w, r, &input); err != nil {
+		h.log.Error("Decoding JSON error", zap.Error(err))
+		return
+	}
+
+	if err = h.service.SetUserRoles(r.Context(), userID, input.Roles); err != nil {
+		h.log.Error("Set user roles error", zap.Error(err), zap.String("user_id", userID.String()))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	h.log.Info("user roles changed", zap.String("admin", admin.Email), zap.String("user_id", userID.String()))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SuspendUser blocks the account for the reason from the body and ends its sessions.
+func (h *AuthHandler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value("user").(*models.User)
+	if !ok || admin == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, appError.BadRequest(appError.ErrInvalidInput))
+		return
+	}
+
+	var input SuspendUserInput
+
+	if err = h.decodeJSON(w, r, &input); err != nil {
+		h.log.Error("Decoding JSON error", zap.Error(err))
+		return
+	}
+
+	if err = h.service.SuspendUser(r.Context(), admin.ID, userID, input.Reason); err != nil {
+		h.log.Error("Suspend user error", zap.Error(err), zap.String("user_id", userID.String()))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	h.log.Info("user suspended", zap.String("admin", admin.Email), zap.String("user_id", userID.String()))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) ActivateUser(w http.ResponseWriter, r *http.Request) {
+	h.adminAction(w, r, "user activated", func(admin *models.User, userID uuid.UUID) error {
+		return h.service.ActivateUser(r.Context(), userID)
+	})
+}
+
+// ForceLogout ends every session of the user.
+func (h *AuthHandler) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	h.adminAction(w, r, "user logged out", func(admin *models.User, userID uuid.UUID) error {
+		return h.service.ForceLogout(r.Context(), userID)
+	})
+}
+
+func (h *AuthHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	h.adminAction(w, r, "user deleted", func(admin *models.User, userID uuid.UUID) error {
+		return h.service.DeleteUser(r.Context(), admin.ID, userID)
+	})
+}
+
+// UnlockUser lifts the lockout of an account after failed logins.
+func (h *AuthHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	h.adminAction(w, r, "user unlocked", func(admin *models.User, userID uuid.UUID) error {
+		return h.service.UnlockUser(r.Context(), userID)
+	})
+}
+
+// adminAction runs an action of the current admin on the user from the {id} path parameter and
+// answers 204 on success.
+func (h *AuthHandler) adminAction(
+	w http.ResponseWriter,
+	r *http.Request,
+	message string,
+	action func(admin *models.User, userID uuid.UUID) error,
+) {
+	admin, ok := r.Context().Value("user").(*models.User)
+	if !ok || admin == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, appError.BadRequest(appError.ErrInvalidInput))
+		return
+	}
+
+	if err = action(admin, userID); err != nil {
+		h.log.Error("Admin action error", zap.Error(err), zap.String("action", message),
+			zap.String("user_id", userID.String()))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	h.log.Info(message, zap.String("admin", admin.Email), zap.String("user_id", userID.String()))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// queryInt returns 0 for a missing parameter.
+func queryInt(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -3,24 +3,36 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	appError "github.com/sanchey92/jwt-example/internal/errors"
 	"github.com/sanchey92/jwt-example/internal/logger"
 	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/pkg/utils"
 )
 
 const (
 	MaxRequestSize = 1048576 // 1MB
 )
 
+// AuthInput only requires a password, the password policy is applied by the service.
 type AuthInput struct {
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+	Password string `json:"password" validate:"required"`
+}
+
+type LoginInput struct {
+	AuthInput
+	DeviceName string `json:"device_name" validate:"omitempty,max=64"`
 }
 
 type RefreshTokenInput struct {
@@ -29,8 +41,52 @@ type RefreshTokenInput struct {
 
 type AuthService interface {
 	Register(ctx context.Context, email, password string) (*models.User, error)
-	Login(ctx context.Context, email, password string) (*models.TokenPair, error)
-	Logout(ctx context.Context, refreshToken string) error
+	Login(ctx context.Context, email, password string, client *models.Session) (*models.TokenPair, *models.MFAChallenge, error)
+	Logout(ctx context.Context, refreshToken, accessToken string) error
+	Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, *models.User, error)
+	LogoutAll(ctx context.Context, userID uuid.UUID) error
+	LogoutOthers(ctx context.Context, user *models.User, sessionID string) (string, error)
+	ListSessions(ctx context.Context, userID uuid.UUID, currentSessionID string) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	ChangePassword(ctx context.Context, user *models.User, sessionID, currentPassword, newPassword string) (string, error)
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerificationEmail(ctx context.Context, email string) error
+	EnrollMFA(ctx context.Context, user *models.User) (*models.MFAEnrollment, error)
+	ConfirmMFA(ctx context.Context, user *models.User, code string) ([]string, error)
+	VerifyMFA(ctx context.Context, mfaToken, code string, client *models.Session) (*models.TokenPair, error)
+	UnlockUser(ctx context.Context, userID uuid.UUID) error
+	ListUsers(ctx context.Context, filter models.UserFilter) (*models.UserPage, error)
+	GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error)
+	SetUserRoles(ctx context.Context, userID uuid.UUID, roles []models.Role) error
+	SuspendUser(ctx context.Context, actorID, userID uuid.UUID, reason string) error
+	ActivateUser(ctx context.Context, userID uuid.UUID) error
+	ForceLogout(ctx context.Context, userID uuid.UUID) error
+	DeleteUser(ctx context.Context, actorID, userID uuid.UUID) error
+	ListRoles(ctx context.Context) ([]models.RoleDefinition, error)
+	ListPermissions(ctx context.Context) ([]models.PermissionDefinition, error)
+	CreateRole(ctx context.Context, name models.Role, description string, permissions []models.Permission) (*models.RoleDefinition, error)
+	SetRolePermissions(ctx context.Context, name models.Role, permissions []models.Permission) error
+	DeleteRole(ctx context.Context, name models.Role) error
+	AssignRole(ctx context.Context, userID uuid.UUID, role models.Role) error
+	RevokeRole(ctx context.Context, userID uuid.UUID, role models.Role) error
+	AuthorizeRequest(ctx context.Context, req *models.AuthorizationRequest) (*models.AuthorizationConsent, error)
+	ApproveAuthorization(
+		ctx context.Context,
+		user *models.User,
+		sessionID string,
+		req *models.AuthorizationRequest,
+		approved bool,
+	) (string, error)
+	ExchangeToken(ctx context.Context, req *models.TokenRequest) (*models.OAuthToken, error)
+	UserInfo(ctx context.Context, claims *utils.Claims) (*models.UserInfo, error)
+	OpenIDConfiguration() *models.OpenIDConfiguration
+	ListOAuthClients(ctx context.Context) ([]models.OAuthClient, error)
+	GetOAuthClient(ctx context.Context, clientID string) (*models.OAuthClient, error)
+	CreateOAuthClient(ctx context.Context, client *models.OAuthClient) (string, error)
+	RotateOAuthClientSecret(ctx context.Context, clientID string) (string, error)
+	DeleteOAuthClient(ctx context.Context, clientID string) error
 }
 
 type AuthHandler struct {
@@ -40,10 +96,13 @@ type AuthHandler struct {
 }
 
 func NewAuthHandler(service AuthService) *AuthHandler {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(jsonFieldName)
+
 	return &AuthHandler{
 		service:   service,
 		log:       logger.GetLogger(),
-		validator: validator.New(),
+		validator: validate,
 	}
 }
 
@@ -58,7 +117,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	user, err := h.service.Register(r.Context(), input.Email, input.Password)
 	if err != nil {
 		h.log.Error("Registration error", zap.Error(err), zap.String("email", input.Email))
-		h.writeError(w, appError.InternalServer(err))
+		h.writeError(w, toApiError(err))
 		return
 	}
 
@@ -70,25 +129,29 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
-	var input AuthInput
+	var input LoginInput
 
 	if err := h.decodeJSON(w, r, &input); err != nil {
 		h.log.Error("Decoding JSON error", zap.Error(err))
 		return
 	}
 
-	tokenPair, err := h.service.Login(r.Context(), input.Email, input.Password)
+	tokenPair, challenge, err := h.service.Login(r.Context(), input.Email, input.Password, newClient(r, input.DeviceName))
 	if err != nil {
 		h.log.Error("Login error", zap.Error(err), zap.String("email", input.Email))
-		h.writeError(w, appError.Unauthorized(err))
+		h.writeError(w, toApiError(err))
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    tokenPair.RefreshToken,
-		HttpOnly: true,
-	})
+	if challenge != nil {
+		h.log.Info("mfa required", zap.String("email", input.Email))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(challenge)
+		return
+	}
+
+	setRefreshCookie(w, tokenPair.RefreshToken)
 
 	h.log.Info("success login", zap.String("email", input.Email))
 
@@ -104,23 +167,99 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.Logout(r.Context(), input.RefreshToken); err != nil {
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	if err := h.service.Logout(r.Context(), input.RefreshToken, accessToken); err != nil {
 		h.log.Error("Logout error", zap.Error(err))
 		h.writeError(w, appError.InternalServer(err))
 		return
 	}
 
-	// Add access token to the black list (with redis for example)
+	setRefreshCookie(w, "")
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    "",
-		HttpOnly: true,
-	})
+	w.WriteHeader(http.StatusOK)
+}
+
+// Refresh exchanges the refresh token from the cookie or, for clients without cookies, from the
+// JSON body for a new token pair. Missing input is 400, an invalid, expired or reused token is 401.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var refreshToken string
+
+	if cookie, err := r.Cookie("refresh_token"); err == nil && cookie.Value != "" {
+		refreshToken = cookie.Value
+	} else {
+		var input RefreshTokenInput
+
+		if err = h.decodeJSON(w, r, &input); err != nil {
+			h.log.Error("Decoding JSON error", zap.Error(err))
+			return
+		}
+		refreshToken = input.RefreshToken
+	}
+
+	tokenPair, user, err := h.service.Refresh(r.Context(), refreshToken)
+	if err != nil {
+		h.log.Error("Refresh error", zap.Error(err))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	// A token refreshed again right after its rotation gets no successor, the cookie stays as it is.
+	if tokenPair.RefreshToken != "" {
+		setRefreshCookie(w, tokenPair.RefreshToken)
+	}
+
+	h.log.Info("success refresh", zap.String("email", user.Email))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(tokenPair)
+}
+
+// LogoutAll ends every session of the current user, including this one.
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok || user == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	if err := h.service.LogoutAll(r.Context(), user.ID); err != nil {
+		h.log.Error("Logout all error", zap.Error(err), zap.String("email", user.Email))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	setRefreshCookie(w, "")
+
+	h.log.Info("logout from all devices", zap.String("email", user.Email))
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// LogoutOthers ends every session of the current user except this one and returns
+// a new access token, because the previous one is invalidated as well.
+func (h *AuthHandler) LogoutOthers(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(*models.User)
+	claims, claimsOk := r.Context().Value("claims").(*utils.Claims)
+	if !ok || user == nil || !claimsOk || claims == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	accessToken, err := h.service.LogoutOthers(r.Context(), user, claims.SessionID)
+	if err != nil {
+		h.log.Error("Logout others error", zap.Error(err), zap.String("email", user.Email))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	h.log.Info("logout from other devices", zap.String("email", user.Email))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"access_token": accessToken})
+}
+
 func (h *AuthHandler) Profile(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value("user").(*models.User)
 	if !ok || user == nil {
@@ -147,15 +286,58 @@ func (h *AuthHandler) decodeJSON(w http.ResponseWriter, r *http.Request, v inter
 	}
 
 	if err := h.validator.Struct(v); err != nil {
-		h.writeError(w, appError.BadRequest(err))
+		h.writeError(w, validationError(err))
 		return fmt.Errorf("validation error: %w", err)
 	}
 
 	return nil
 }
 
+// newClient describes the caller for the session list, deviceName overrides the label derived from User-Agent.
+func newClient(r *http.Request, deviceName string) *models.Session {
+	client := &models.Session{
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+		Device:    deviceName,
+	}
+	if client.Device == "" {
+		client.Device = utils.DeviceLabel(client.UserAgent)
+	}
+
+	return client
+}
+
+func setRefreshCookie(w http.ResponseWriter, refreshToken string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshToken,
+		HttpOnly: true,
+	})
+}
+
+// toApiError keeps the status code of errors already classified by the service.
+func toApiError(err error) *appError.ApiError {
+	var apiErr *appError.ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return appError.InternalServer(appError.ErrInternalServer)
+}
+
 func (h *AuthHandler) writeError(w http.ResponseWriter, apiError *appError.ApiError) {
 	w.Header().Set("Content-Type", "application/json")
+	if apiError.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(apiError.RetryAfter.Seconds()))))
+	}
 	w.WriteHeader(apiError.StatusCode)
-	json.NewEncoder(w).Encode(map[string]string{"error": apiError.Message})
+
+	body := map[string]interface{}{"error": apiError.Message}
+	if apiError.Code != "" {
+		body["code"] = apiError.Code
+	}
+	if len(apiError.Fields) > 0 {
+		body["fields"] = apiError.Fields
+	}
+
+	json.NewEncoder(w).Encode(body)
 }
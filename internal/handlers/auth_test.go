@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+)
+
+// failingAuthService fails ListUsers, calling any other method panics.
+type failingAuthService struct {
+	AuthService
+	err error
+}
+
+func (s *failingAuthService) ListUsers(context.Context, models.UserFilter) (*models.UserPage, error) {
+	return nil, s.err
+}
+
+func TestAuthHandler_HidesServerErrors(t *testing.T) {
+	repoErr := errors.New(`ERROR: relation "users" does not exist (SQLSTATE 42P01)`)
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "classified by the service", err: appError.InternalServer(repoErr)},
+		{name: "unclassified", err: repoErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &AuthHandler{
+				service:   &failingAuthService{err: tt.err},
+				log:       zap.NewNop(),
+				validator: validator.New(),
+			}
+
+			rec := httptest.NewRecorder()
+			h.ListUsers(rec, httptest.NewRequest(http.MethodGet, "/admin/users", nil))
+
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.JSONEq(t, `{"error":"internal server error"}`, rec.Body.String())
+			assert.NotContains(t, rec.Body.String(), "SQLSTATE")
+		})
+	}
+}
+
+func TestAuthHandler_ProfileKeepsRole(t *testing.T) {
+	h := &AuthHandler{log: zap.NewNop(), validator: validator.New()}
+	user := &models.User{Email: "user@example.com", Roles: []models.Role{"auditor", models.RoleAdmin}}
+
+	req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "user", user))
+
+	rec := httptest.NewRecorder()
+	h.Profile(rec, req)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "admin", body["role"])
+	assert.Equal(t, []interface{}{"auditor", "admin"}, body["roles"])
+	assert.Equal(t, "user@example.com", body["email"])
+	assert.NotContains(t, body, "Password")
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+)
+
+type OAuthClientInput struct {
+	Name         string   `json:"name" validate:"required,max=128"`
+	RedirectURIs []string `json:"redirect_uris" validate:"dive,required,max=2048"`
+	Scopes       []string `json:"scopes" validate:"dive,required,max=64"`
+	GrantTypes   []string `json:"grant_types" validate:"required,dive,required"`
+	Confidential bool     `json:"confidential"`
+}
+
+// OAuthClientCredentials answers the registration of a client. ClientSecret is only shown here.
+type OAuthClientCredentials struct {
+	*models.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// CurrentClient returns the OAuth client calling with a client_credentials token, so a service can
+// check its credentials and scopes.
+func (h *AuthHandler) CurrentClient(w http.ResponseWriter, r *http.Request) {
+	client, ok := r.Context().Value("client").(*models.OAuthClient)
+	if !ok || client == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(client)
+}
+
+func (h *AuthHandler) ListOAuthClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.service.ListOAuthClients(r.Context())
+	if err != nil {
+		h.log.Error("List OAuth clients error", zap.Error(err))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clients)
+}
+
+func (h *AuthHandler) GetOAuthClient(w http.ResponseWriter, r *http.Request) {
+	clientID := chi.URLParam(r, "id")
+
+	client, err := h.service.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		h.log.Error("Get OAuth client error", zap.Error(err), zap.String("client_id", clientID))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(client)
+}
+
+// CreateOAuthClient registers a client and returns it with its secret, if it is confidential.
+func (h *AuthHandler) CreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	var input OAuthClientInput
+
+	if err := h.decodeJSON(w, r, &input); err != nil {
+		h.log.Error("Decoding JSON error", zap.Error(err))
+		return
+	}
+
+	client := &models.OAuthClient{
+		Name:         input.Name,
+		RedirectURIs: input.RedirectURIs,
+		Scopes:       input.Scopes,
+		GrantTypes:   input.GrantTypes,
+		Confidential: input.Confidential,
+	}
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+	if client.Scopes == nil {
+		client.Scopes = []string{}
+	}
+
+	secret, err := h.service.CreateOAuthClient(r.Context(), client)
+	if err != nil {
+		h.log.Error("Create OAuth client error", zap.Error(err), zap.String("name", input.Name))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(OAuthClientCredentials{OAuthClient: client, ClientSecret: secret})
+}
+
+// RotateOAuthClientSecret returns a new {"client_secret"} for a confidential client.
+func (h *AuthHandler) RotateOAuthClientSecret(w http.ResponseWriter, r *http.Request) {
+	clientID := chi.URLParam(r, "id")
+
+	secret, err := h.service.RotateOAuthClientSecret(r.Context(), clientID)
+	if err != nil {
+		h.log.Error("Rotate OAuth client secret error", zap.Error(err), zap.String("client_id", clientID))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"client_secret": secret})
+}
+
+func (h *AuthHandler) DeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	clientID := chi.URLParam(r, "id")
+
+	if err := h.service.DeleteOAuthClient(r.Context(), clientID); err != nil {
+		h.log.Error("Delete OAuth client error", zap.Error(err), zap.String("client_id", clientID))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/logger"
+	"github.com/sanchey92/jwt-example/pkg/jwk"
+)
+
+type KeyPublisher interface {
+	JWKS() (jwk.Set, error)
+}
+
+type JWKSHandler struct {
+	keys   KeyPublisher
+	maxAge time.Duration
+	log    *zap.Logger
+}
+
+// NewJWKSHandler serves the verification keys. maxAge should stay well below the key grace period,
+// so consumers pick up a rotated key before the previous one is retired.
+func NewJWKSHandler(keys KeyPublisher, maxAge time.Duration) *JWKSHandler {
+	return &JWKSHandler{
+		keys:   keys,
+		maxAge: maxAge,
+		log:    logger.GetLogger(),
+	}
+}
+
+func (h *JWKSHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	set, err := h.keys.JWKS()
+	if err != nil {
+		h.log.Error("Failed to build JWKS", zap.Error(err))
+		h.writeError(w, appError.InternalServer(appError.ErrInternalServer))
+		return
+	}
+
+	body, err := json.Marshal(set)
+	if err != nil {
+		h.log.Error("Failed to encode JWKS", zap.Error(err))
+		h.writeError(w, appError.InternalServer(appError.ErrInternalServer))
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, must-revalidate", int(h.maxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Write(body)
+}
+
+func (h *JWKSHandler) writeError(w http.ResponseWriter, apiError *appError.ApiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiError.StatusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": apiError.Message})
+}
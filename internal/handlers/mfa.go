@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+)
+
+type MFACodeInput struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type VerifyMFAInput struct {
+	MFAToken   string `json:"mfa_token" validate:"required"`
+	Code       string `json:"code" validate:"required,max=32"`
+	DeviceName string `json:"device_name" validate:"omitempty,max=64"`
+}
+
+// EnrollMFA returns a new TOTP secret and its otpauth:// URI for the current user.
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok || user == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	enrollment, err := h.service.EnrollMFA(r.Context(), user)
+	if err != nil {
+		h.log.Error("MFA enroll error", zap.Error(err), zap.String("email", user.Email))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(enrollment)
+}
+
+// ConfirmMFA enables MFA with the first code from the authenticator app and returns the recovery codes.
+func (h *AuthHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok || user == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	var input MFACodeInput
+
+	if err := h.decodeJSON(w, r, &input); err != nil {
+		h.log.Error("Decoding JSON error", zap.Error(err))
+		return
+	}
+
+	codes, err := h.service.ConfirmMFA(r.Context(), user, input.Code)
+	if err != nil {
+		h.log.Error("MFA confirm error", zap.Error(err), zap.String("email", user.Email))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	h.log.Info("mfa enabled", zap.String("email", user.Email))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+}
+
+// VerifyMFA exchanges the challenge from /login and a TOTP or recovery code for a token pair.
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var input VerifyMFAInput
+
+	if err := h.decodeJSON(w, r, &input); err != nil {
+		h.log.Error("Decoding JSON error", zap.Error(err))
+		return
+	}
+
+	tokenPair, err := h.service.VerifyMFA(r.Context(), input.MFAToken, input.Code, newClient(r, input.DeviceName))
+	if err != nil {
+		h.log.Error("MFA verify error", zap.Error(err))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	setRefreshCookie(w, tokenPair.RefreshToken)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"access_token": tokenPair.AccessToken})
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+// ApproveAuthorizationInput repeats the authorization request shown on the consent screen together
+// with the decision of the user.
+type ApproveAuthorizationInput struct {
+	models.AuthorizationRequest
+	Approved bool `json:"approved"`
+}
+
+// Authorize validates an authorization request given in the query string and returns what the
+// consent screen shows. The user must be signed in with a first-party token.
+func (h *AuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := &models.AuthorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+		Nonce:               query.Get("nonce"),
+	}
+
+	consent, err := h.service.AuthorizeRequest(r.Context(), req)
+	if err != nil {
+		h.log.Error("Authorization request error", zap.Error(err), zap.String("client_id", req.ClientID))
+		h.writeOAuthError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(consent)
+}
+
+// ApproveAuthorization records the consent decision and returns the URL to send the user back to.
+func (h *AuthHandler) ApproveAuthorization(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(*models.User)
+	claims, claimsOk := r.Context().Value("claims").(*utils.Claims)
+	if !ok || user == nil || !claimsOk || claims == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	var input ApproveAuthorizationInput
+
+	if err := h.decodeJSON(w, r, &input); err != nil {
+		h.log.Error("Decoding JSON error", zap.Error(err))
+		return
+	}
+
+	redirectTo, err := h.service.ApproveAuthorization(
+		r.Context(), user, claims.SessionID, &input.AuthorizationRequest, input.Approved)
+	if err != nil {
+		h.log.Error("Authorization approval error", zap.Error(err), zap.String("client_id", input.ClientID))
+		h.writeOAuthError(w, toApiError(err))
+		return
+	}
+
+	h.log.Info("Authorization decided",
+		zap.String("user_id", user.ID.String()),
+		zap.String("client_id", input.ClientID),
+		zap.Bool("approved", input.Approved),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"redirect_to": redirectTo})
+}
+
+// Token is the OAuth 2.0 token endpoint, it takes form-encoded parameters as RFC 6749 requires.
+// Confidential clients authenticate with HTTP Basic or client_id and client_secret in the form.
+func (h *AuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestSize)
+	if err := r.ParseForm(); err != nil {
+		h.writeOAuthError(w, appError.OAuthError(http.StatusBadRequest, "invalid_request", "malformed form body"))
+		return
+	}
+
+	req := &models.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		Scope:        r.PostForm.Get("scope"),
+	}
+
+	// HTTP Basic credentials are form-encoded before they are joined (RFC 6749 section 2.3.1).
+	if id, secret, ok := r.BasicAuth(); ok {
+		req.ClientID, _ = url.QueryUnescape(id)
+		req.ClientSecret, _ = url.QueryUnescape(secret)
+	}
+
+	token, err := h.service.ExchangeToken(r.Context(), req)
+	if err != nil {
+		h.log.Error("Token request error", zap.Error(err), zap.String("client_id", req.ClientID))
+		h.writeOAuthError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(token)
+}
+
+// UserInfo is the OpenID Connect userinfo endpoint, it answers GET and POST alike.
+func (h *AuthHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("claims").(*utils.Claims)
+	if !ok || claims == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	info, err := h.service.UserInfo(r.Context(), claims)
+	if err != nil {
+		h.log.Error("Userinfo error", zap.Error(err), zap.String("sub", claims.Subject))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(info)
+}
+
+// OpenIDConfiguration serves the OpenID Connect discovery document.
+func (h *AuthHandler) OpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(h.service.OpenIDConfiguration())
+}
+
+// writeOAuthError writes errors in the format of RFC 6749 section 5.2. Errors the client should
+// receive at its redirect URI carry it in redirect_to.
+func (h *AuthHandler) writeOAuthError(w http.ResponseWriter, apiError *appError.ApiError) {
+	code := apiError.Code
+	if code == "" {
+		code = "server_error"
+	}
+
+	body := map[string]string{"error": code, "error_description": apiError.Message}
+	if apiError.Location != "" {
+		body["redirect_to"] = apiError.Location
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(apiError.StatusCode)
+	json.NewEncoder(w).Encode(body)
+}
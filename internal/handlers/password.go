@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+// ForgotPassword always answers 202 so the response does not tell whether the email is registered.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input ForgotPasswordInput
+
+	if err := h.decodeJSON(w, r, &input); err != nil {
+		h.log.Error("Decoding JSON error", zap.Error(err))
+		return
+	}
+
+	if err := h.service.ForgotPassword(r.Context(), input.Email); err != nil {
+		h.log.Error("Forgot password error", zap.Error(err))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password from a reset token and logs the user out everywhere.
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input ResetPasswordInput
+
+	if err := h.decodeJSON(w, r, &input); err != nil {
+		h.log.Error("Decoding JSON error", zap.Error(err))
+		return
+	}
+
+	if err := h.service.ResetPassword(r.Context(), input.Token, input.Password); err != nil {
+		h.log.Error("Reset password error", zap.Error(err))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	setRefreshCookie(w, "")
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ChangePassword replaces the password of the current user, ends their other sessions and returns
+// a new access token for this one.
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(*models.User)
+	claims, claimsOk := r.Context().Value("claims").(*utils.Claims)
+	if !ok || user == nil || !claimsOk || claims == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	var input ChangePasswordInput
+
+	if err := h.decodeJSON(w, r, &input); err != nil {
+		h.log.Error("Decoding JSON error", zap.Error(err))
+		return
+	}
+
+	accessToken, err := h.service.ChangePassword(r.Context(), user, claims.SessionID, input.CurrentPassword, input.NewPassword)
+	if err != nil {
+		h.log.Error("Change password error", zap.Error(err), zap.String("email", user.Email))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	h.log.Info("password changed", zap.String("email", user.Email))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"access_token": accessToken})
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+)
+
+type RoleInput struct {
+	Name        models.Role         `json:"name" validate:"required,max=64,excludesall= /"`
+	Description string              `json:"description" validate:"max=256"`
+	Permissions []models.Permission `json:"permissions" validate:"dive,required"`
+}
+
+type RolePermissionsInput struct {
+	Permissions []models.Permission `json:"permissions" validate:"required,dive,required"`
+}
+
+type UserRoleInput struct {
+	Role models.Role `json:"role" validate:"required,max=64"`
+}
+
+// ListRoles returns all roles with the permissions they grant.
+func (h *AuthHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.service.ListRoles(r.Context())
+	if err != nil {
+		h.log.Error("List roles error", zap.Error(err))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roles)
+}
+
+// ListPermissions returns the permissions roles can grant.
+func (h *AuthHandler) ListPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := h.service.ListPermissions(r.Context())
+	if err != nil {
+		h.log.Error("List permissions error", zap.Error(err))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(permissions)
+}
+
+func (h *AuthHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	var input RoleInput
+
+	if err := h.decodeJSON(w, r, &input); err != nil {
+		h.log.Error("Decoding JSON error", zap.Error(err))
+		return
+	}
+
+	role, err := h.service.CreateRole(r.Context(), input.Name, input.Description, input.Permissions)
+	if err != nil {
+		h.log.Error("Create role error", zap.Error(err), zap.String("role", string(input.Name)))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(role)
+}
+
+// SetRolePermissions replaces the permissions granted by the role.
+func (h *AuthHandler) SetRolePermissions(w http.ResponseWriter, r *http.Request) {
+	var input RolePermissionsInput
+
+	if err := h.decodeJSON(w, r, &input); err != nil {
+		h.log.Error("Decoding JSON error", zap.Error(err))
+		return
+	}
+
+	name := models.Role(chi.URLParam(r, "name"))
+
+	if err := h.service.SetRolePermissions(r.Context(), name, input.Permissions); err != nil {
+		h.log.Error("Set role permissions error", zap.Error(err), zap.String("role", string(name)))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	name := models.Role(chi.URLParam(r, "name"))
+
+	if err := h.service.DeleteRole(r.Context(), name); err != nil {
+		h.log.Error("Delete role error", zap.Error(err), zap.String("role", string(name)))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AssignRole gives the user from the path the role from the body.
+func (h *AuthHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value("user").(*models.User)
+	if !ok || admin == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, appError.BadRequest(appError.ErrInvalidInput))
+		return
+	}
+
+	var input UserRoleInput
+
+	if err = h.decodeJSON(w, r, &input); err != nil {
+		h.log.Error("Decoding JSON error", zap.Error(err))
+		return
+	}
+
+	if err = h.service.AssignRole(r.Context(), userID, input.Role); err != nil {
+		h.log.Error("Assign role error", zap.Error(err), zap.String("user_id", userID.String()))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	h.log.Info("role assigned", zap.String("admin", admin.Email), zap.String("user_id", userID.String()),
+		zap.String("role", string(input.Role)))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeRole takes the role from the path away from the user.
+func (h *AuthHandler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value("user").(*models.User)
+	if !ok || admin == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, appError.BadRequest(appError.ErrInvalidInput))
+		return
+	}
+
+	role := models.Role(chi.URLParam(r, "role"))
+
+	if err = h.service.RevokeRole(r.Context(), userID, role); err != nil {
+		h.log.Error("Revoke role error", zap.Error(err), zap.String("user_id", userID.String()))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	h.log.Info("role revoked", zap.String("admin", admin.Email), zap.String("user_id", userID.String()),
+		zap.String("role", string(role)))
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+// ListSessions returns the devices the current user is logged in on.
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok || user == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	var currentSessionID string
+	if claims, ok := r.Context().Value("claims").(*utils.Claims); ok && claims != nil {
+		currentSessionID = claims.SessionID
+	}
+
+	sessions, err := h.service.ListSessions(r.Context(), user.ID, currentSessionID)
+	if err != nil {
+		h.log.Error("List sessions error", zap.Error(err), zap.String("email", user.Email))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// DeleteSession logs the current user out of one device.
+func (h *AuthHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok || user == nil {
+		h.writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+		return
+	}
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeError(w, appError.BadRequest(appError.ErrInvalidInput))
+		return
+	}
+
+	if err = h.service.RevokeSession(r.Context(), user.ID, sessionID); err != nil {
+		h.log.Error("Delete session error", zap.Error(err), zap.String("email", user.Email))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	h.log.Info("session revoked", zap.String("email", user.Email), zap.String("session_id", sessionID.String()))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
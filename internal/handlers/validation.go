@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+)
+
+// validationError reports validator failures per JSON field, the same shape the service uses for
+// password policy violations.
+func validationError(err error) *appError.ApiError {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return appError.BadRequest(appError.ErrInvalidInput)
+	}
+
+	fields := make(map[string][]string, len(validationErrors))
+	for _, fe := range validationErrors {
+		fields[fe.Field()] = append(fields[fe.Field()], fieldMessage(fe))
+	}
+
+	return appError.ValidationFailed(fields)
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return fmt.Sprintf("must be at least %s characters long", fe.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s characters long", fe.Param())
+	default:
+		return "is invalid"
+	}
+}
+
+// jsonFieldName makes validator report fields under their JSON names.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidationError(t *testing.T) {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(jsonFieldName)
+
+	err := validate.Struct(&LoginInput{
+		AuthInput:  AuthInput{Email: "not-an-email"},
+		DeviceName: string(make([]byte, 65)),
+	})
+
+	apiErr := validationError(err)
+
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, map[string][]string{
+		"email":       {"must be a valid email address"},
+		"password":    {"is required"},
+		"device_name": {"must be at most 64 characters long"},
+	}, apiErr.Fields)
+}
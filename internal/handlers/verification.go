@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+)
+
+type ResendVerificationInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// VerifyEmail handles the link from the verification email.
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		h.writeError(w, appError.BadRequest(appError.ErrInvalidInput))
+		return
+	}
+
+	if err := h.service.VerifyEmail(r.Context(), token); err != nil {
+		h.log.Error("Verify email error", zap.Error(err))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "verified"})
+}
+
+// ResendVerification always answers 202 so the response does not tell whether the email is registered.
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var input ResendVerificationInput
+
+	if err := h.decodeJSON(w, r, &input); err != nil {
+		h.log.Error("Decoding JSON error", zap.Error(err))
+		return
+	}
+
+	if err := h.service.ResendVerificationEmail(r.Context(), input.Email); err != nil {
+		h.log.Error("Resend verification error", zap.Error(err))
+		h.writeError(w, toApiError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,59 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers emails to users. Production deployments plug in an SMTP or API based implementation.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// WriterSender prints messages instead of delivering them, for local development.
+type WriterSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSender(w io.Writer) *WriterSender {
+	return &WriterSender{w: w}
+}
+
+func NewStdoutSender() *WriterSender {
+	return NewWriterSender(os.Stdout)
+}
+
+// NewFileSender appends messages to the file at path. The returned close function releases the file.
+func NewFileSender(path string) (*WriterSender, func() error, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return NewWriterSender(file), file.Close, nil
+}
+
+func (s *WriterSender) Send(_ context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.w, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	return err
+}
@@ -0,0 +1,42 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterSender(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := NewWriterSender(&buf).Send(context.Background(), Message{
+		To:      "test@example.com",
+		Subject: "Hello",
+		Body:    "World",
+	})
+
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "To: test@example.com\n")
+	assert.Contains(t, buf.String(), "Subject: Hello\n\nWorld")
+}
+
+func TestFileSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail", "outbox.log")
+
+	sender, closeFn, err := NewFileSender(path)
+	require.NoError(t, err)
+
+	require.NoError(t, sender.Send(context.Background(), Message{To: "a@example.com", Subject: "first"}))
+	require.NoError(t, sender.Send(context.Background(), Message{To: "b@example.com", Subject: "second"}))
+	require.NoError(t, closeFn())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Subject: first")
+	assert.Contains(t, string(data), "Subject: second")
+}
@@ -7,79 +7,122 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/sanchey92/jwt-example/internal/config"
 	appError "github.com/sanchey92/jwt-example/internal/errors"
 	"github.com/sanchey92/jwt-example/internal/service"
-	"github.com/sanchey92/jwt-example/pkg/utils"
 )
 
-func Authenticate(service *service.AuthService, cfg *config.Config) func(next http.Handler) http.Handler {
+func Authenticate(service *service.AuthService) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			tokenStr, ok := bearerToken(r)
+			if !ok {
 				writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
 				return
 			}
 
-			tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-
-			user, err := service.ExtractUserFromToken(r.Context(), tokenStr, cfg.JWTAccessSecret)
+			user, claims, err := service.ExtractUserFromToken(r.Context(), tokenStr)
 			if err != nil {
 				if errors.Is(err, appError.ErrTokenExpired) {
-					handleTokenExpired(w, r, service, cfg, next)
+					handleTokenExpired(w, r, service, next)
 					return
 				}
-				writeError(w, appError.Unauthorized(err))
+				writeError(w, toApiError(err))
 				return
 			}
 
 			ctx := context.WithValue(r.Context(), "user", user)
+			ctx = context.WithValue(ctx, "claims", claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// AuthenticateClient guards routes for other services. It only accepts access tokens issued to an
+// OAuth client with the client_credentials grant and stores the client under "client". Expired
+// tokens are not refreshed, the client asks the token endpoint for a new one.
+func AuthenticateClient(service *service.AuthService) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenStr, ok := bearerToken(r)
+			if !ok {
+				writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+				return
+			}
+
+			client, claims, err := service.ExtractClientFromToken(r.Context(), tokenStr)
+			if err != nil {
+				writeError(w, toApiError(err))
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "client", client)
+			ctx = context.WithValue(ctx, "claims", claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-func handleTokenExpired(w http.ResponseWriter, r *http.Request, service *service.AuthService, cfg *config.Config, next http.Handler) {
+func bearerToken(r *http.Request) (string, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return "", false
+	}
+
+	return strings.TrimPrefix(authHeader, "Bearer "), true
+}
+
+func handleTokenExpired(w http.ResponseWriter, r *http.Request, service *service.AuthService, next http.Handler) {
 	tokenCookie, err := r.Cookie("refresh_token")
 	if err != nil {
 		writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
 		return
 	}
 
-	refreshToken, user, err := service.ExtractUserFromRefreshToken(r.Context(), tokenCookie.Value)
+	tokenPair, user, err := service.Refresh(r.Context(), tokenCookie.Value)
 	if err != nil {
-		writeError(w, appError.Unauthorized(err))
+		writeError(w, toApiError(err))
 		return
 	}
 
-	if service.IsRefreshTokenExpired(refreshToken) {
-		newRefresh, err := service.GetNewRefreshToken(r.Context(), user.ID, refreshToken.Token)
-		if err != nil {
-			writeError(w, appError.Unauthorized(err))
-			return
-		}
+	if tokenPair.RefreshToken != "" {
 		http.SetCookie(w, &http.Cookie{
 			Name:     "refresh_token",
-			Value:    newRefresh,
+			Value:    tokenPair.RefreshToken,
 			HttpOnly: true,
 		})
 	}
 
-	newAccess, err := utils.GenerateJWTToken(user, cfg.AccessTokenTTL, cfg.JWTAccessSecret)
+	claims, err := service.ParseAccessToken(tokenPair.AccessToken)
 	if err != nil {
 		writeError(w, appError.Unauthorized(appError.ErrInternalServer))
 		return
 	}
 
-	w.Header().Set("Authorization", "Bearer "+newAccess)
+	w.Header().Set("Authorization", "Bearer "+tokenPair.AccessToken)
 
 	ctx := context.WithValue(r.Context(), "user", user)
+	ctx = context.WithValue(ctx, "claims", claims)
 
 	next.ServeHTTP(w, r.WithContext(ctx))
 }
 
+// toApiError keeps errors classified by the service, such as a suspended account, and reports
+// anything else as 401.
+func toApiError(err error) *appError.ApiError {
+	var apiErr *appError.ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return appError.Unauthorized(err)
+}
+
 func writeError(w http.ResponseWriter, apiErr *appError.ApiError) {
 	w.WriteHeader(apiErr.StatusCode)
-	json.NewEncoder(w).Encode(map[string]string{"error": apiErr.Message})
+
+	body := map[string]string{"error": apiErr.Message}
+	if apiErr.Code != "" {
+		body["code"] = apiErr.Code
+	}
+
+	json.NewEncoder(w).Encode(body)
 }
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net/http"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+// RequireRole lets a request through when its access token carries one of roles.
+// It reads the claims stored by Authenticate, so it must be used after it.
+func RequireRole(roles ...models.Role) func(next http.Handler) http.Handler {
+	return authorize(func(claims *utils.Claims) bool {
+		for _, role := range roles {
+			if claims.HasRole(role) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RequirePermission lets a request through when its access token carries every listed permission.
+// Permissions are embedded at issuance, so no lookup is needed.
+func RequirePermission(permissions ...models.Permission) func(next http.Handler) http.Handler {
+	return authorize(func(claims *utils.Claims) bool {
+		for _, permission := range permissions {
+			if !claims.HasPermission(permission) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequireScope lets tokens issued to an OAuth client through when they were granted every listed
+// scope. First-party tokens of the user are not limited by scopes.
+func RequireScope(scopes ...string) func(next http.Handler) http.Handler {
+	return authorize(func(claims *utils.Claims) bool {
+		if claims.ClientID == "" {
+			return true
+		}
+		for _, scope := range scopes {
+			if !claims.HasScope(scope) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequireFirstParty refuses tokens issued to OAuth clients, keeping account management to the
+// user's own sessions.
+func RequireFirstParty() func(next http.Handler) http.Handler {
+	return authorize(func(claims *utils.Claims) bool {
+		return claims.ClientID == ""
+	})
+}
+
+func authorize(allowed func(claims *utils.Claims) bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(*utils.Claims)
+			if !ok || claims == nil {
+				writeError(w, appError.Unauthorized(appError.ErrUnauthorized))
+				return
+			}
+
+			if !allowed(claims) {
+				writeError(w, appError.Forbidden(appError.ErrForbidden))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
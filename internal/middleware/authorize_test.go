@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+func withClaims(claims *utils.Claims) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if claims != nil {
+				r = r.WithContext(context.WithValue(r.Context(), "claims", claims))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	admin := &utils.Claims{
+		Roles:       []models.Role{models.RoleUser, models.RoleAdmin},
+		Permissions: []models.Permission{models.PermissionUsersRead, models.PermissionUsersUnlock},
+	}
+	user := &utils.Claims{Roles: []models.Role{models.RoleUser}}
+	client := &utils.Claims{ClientID: "example-app", Scope: models.ScopeProfile}
+
+	tests := []struct {
+		name       string
+		claims     *utils.Claims
+		guard      func(next http.Handler) http.Handler
+		wantStatus int
+	}{
+		{
+			name:       "role allowed",
+			claims:     admin,
+			guard:      RequireRole(models.RoleAdmin),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "role denied",
+			claims:     user,
+			guard:      RequireRole(models.RoleAdmin),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "permission granted",
+			claims:     admin,
+			guard:      RequirePermission(models.PermissionUsersRead, models.PermissionUsersUnlock),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "permission missing",
+			claims:     user,
+			guard:      RequirePermission(models.PermissionUsersRead),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "one of several permissions missing",
+			claims:     admin,
+			guard:      RequirePermission(models.PermissionUsersRead, models.PermissionRolesWrite),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "first-party token ignores scopes",
+			claims:     user,
+			guard:      RequireScope(models.ScopeProfile),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "scope granted",
+			claims:     client,
+			guard:      RequireScope(models.ScopeProfile),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "scope missing",
+			claims:     client,
+			guard:      RequireScope("email"),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "delegated token on first-party route",
+			claims:     client,
+			guard:      RequireFirstParty(),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "not authenticated",
+			guard:      RequireRole(models.RoleUser),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.Use(withClaims(tt.claims))
+			r.Group(func(r chi.Router) {
+				r.Use(tt.guard)
+				r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+			})
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
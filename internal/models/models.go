@@ -1,11 +1,14 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Role names a row of the roles table. RoleAdmin and RoleUser are created by the migrations and
+// cannot be deleted, RoleUser is assigned on registration.
 type Role string
 
 const (
@@ -13,23 +16,305 @@ const (
 	RoleUser  Role = "user"
 )
 
+// Permission names an operation a route can be guarded by. Roles grant permissions, a user has
+// the permissions of all their roles.
+type Permission string
+
+const (
+	PermissionUsersRead    Permission = "users:read"
+	PermissionUsersWrite   Permission = "users:write"
+	PermissionUsersUnlock  Permission = "users:unlock"
+	PermissionRolesRead    Permission = "roles:read"
+	PermissionRolesWrite   Permission = "roles:write"
+	PermissionClientsRead  Permission = "clients:read"
+	PermissionClientsWrite Permission = "clients:write"
+)
+
+// UserStatus is the lifecycle state of an account. Pending accounts wait for email verification,
+// suspended and deleted ones are set by admins; deleted accounts are kept so their email stays taken.
+type UserStatus string
+
+const (
+	UserStatusActive    UserStatus = "active"
+	UserStatusSuspended UserStatus = "suspended"
+	UserStatusPending   UserStatus = "pending"
+	UserStatusDeleted   UserStatus = "deleted"
+)
+
+// RoleDefinition is a role with the permissions it grants.
+type RoleDefinition struct {
+	Name        Role         `json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+type PermissionDefinition struct {
+	Name        Permission `json:"name"`
+	Description string     `json:"description"`
+}
+
 type User struct {
 	ID        uuid.UUID `json:"id"`
 	Email     string    `json:"email"`
 	Password  string    `json:"-"`
-	Role      Role      `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Roles     []Role    `json:"roles"`
+	// Effective permissions granted by Roles, loaded with the user and embedded into access tokens.
+	Permissions []Permission `json:"permissions,omitempty"`
+	// Nil until the user opens the link from the verification email.
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// Base32 TOTP secret, set on enrollment and active once MFAEnabledAt is set.
+	MFASecret    string     `json:"-"`
+	MFAEnabledAt *time.Time `json:"mfa_enabled_at,omitempty"`
+	// Only active users can log in, see UserStatus. StatusReason is the admin's note on the last change.
+	Status          UserStatus `json:"status"`
+	StatusReason    string     `json:"status_reason,omitempty"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	// Access tokens carry the version they were issued with, bumping it rejects them all, e.g. on
+	// logout from all devices.
+	TokenVersion int64 `json:"-"`
 }
 
+// MarshalJSON adds the deprecated role field of earlier releases next to roles, kept for one release
+// so clients can move to roles. It holds LegacyRole(Roles).
+func (u User) MarshalJSON() ([]byte, error) {
+	type user User
+	return json.Marshal(struct {
+		user
+		Role Role `json:"role,omitempty"`
+	}{user(u), LegacyRole(u.Roles)})
+}
+
+// LegacyRole picks the single role reported by earlier releases: RoleAdmin when the user has it,
+// the first role otherwise.
+func LegacyRole(roles []Role) Role {
+	for _, r := range roles {
+		if r == RoleAdmin {
+			return r
+		}
+	}
+
+	if len(roles) == 0 {
+		return ""
+	}
+
+	return roles[0]
+}
+
+// UserFilter selects a page of users for the admin API. Email matches any part of the address,
+// case-insensitively; an empty Status matches every status.
+type UserFilter struct {
+	Email  string
+	Status UserStatus
+	Limit  int
+	Offset int
+}
+
+type UserPage struct {
+	Users  []User `json:"users"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// RefreshToken belongs to a family: the chain of tokens created by rotating the token issued at login.
+// A rotated token stays in storage with RotatedAt set, so presenting it again can be detected as reuse.
 type RefreshToken struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
-	Token     string    `json:"token"`
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	FamilyID  uuid.UUID  `json:"family_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// SigningKey is an access token signing key created by scheduled rotation. It signs from
+// ActivatesAt until the next key activates. The private key is stored sealed, never in plaintext.
+type SigningKey struct {
+	KeyID       string
+	Algorithm   string
+	SealedKey   []byte
+	ActivatesAt time.Time
+	CreatedAt   time.Time
+}
+
+// PasswordResetToken is a single-use token mailed to the user. Only its hash is stored.
+type PasswordResetToken struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+// RecoveryCode replaces a TOTP code once, for users who lost their authenticator.
+type RecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    *time.Time
+}
+
+// MFAEnrollment is shown once to the user to set up an authenticator app.
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// MFAChallenge is returned by login instead of a token pair when the user has MFA enabled.
+type MFAChallenge struct {
+	Token     string    `json:"mfa_token"`
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
+// LoginAttempt counts consecutive failed logins for an account or a client IP.
+type LoginAttempt struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+}
+
+// Session is one login of a user on a device. Its ID is the family ID of the session's refresh tokens.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserID     uuid.UUID `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Device     string    `json:"device"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+// TokenPair is issued at login and by refresh. RefreshToken is empty when a token rotated moments
+// ago is refreshed again, its successor was already issued.
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// Scopes a user can grant to an OAuth client. ScopeProfile lets it read the profile of the user,
+// ScopeOpenID asks for an OpenID Connect ID token and ScopeEmail adds the email claims to it.
+const (
+	ScopeProfile = "profile"
+	ScopeOpenID  = "openid"
+	ScopeEmail   = "email"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// OAuthClient is an application registered for the OAuth 2.0 grants in GrantTypes. Public clients
+// prove possession of an authorization code with PKCE; confidential ones also authenticate with a
+// secret, of which only the hash is stored. Only confidential clients may use client_credentials.
+type OAuthClient struct {
+	ID           string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	GrantTypes   []string  `json:"grant_types"`
+	Confidential bool      `json:"confidential"`
+	SecretHash   string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	for _, g := range c.GrantTypes {
+		if g == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizationRequest holds the parameters of an OAuth 2.0 authorization request (RFC 6749, RFC 7636).
+type AuthorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Nonce               string `json:"nonce,omitempty"`
+}
+
+// AuthorizationConsent describes a valid authorization request, shown to the user before approval.
+type AuthorizationConsent struct {
+	ClientID    string   `json:"client_id"`
+	ClientName  string   `json:"client_name"`
+	RedirectURI string   `json:"redirect_uri"`
+	Scopes      []string `json:"scopes"`
+	State       string   `json:"state,omitempty"`
+}
+
+// AuthorizationCode is issued on approval and exchanged once for an access token. Only its hash is
+// stored. RedirectURI is the value of the authorization request, possibly empty, which the token
+// request has to repeat. Nonce and AuthTime go into the ID token.
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        uuid.UUID
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	Nonce         string
+	AuthTime      time.Time // when the user signed in to the session that approved the request
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+	UsedAt        *time.Time
+}
+
+// TokenRequest holds the form parameters of a request to the token endpoint. The client
+// credentials may also come from HTTP Basic authentication.
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientID     string
+	ClientSecret string
+	CodeVerifier string
+	Scope        string
+}
+
+// OAuthToken is the token endpoint response (RFC 6749 section 5.1).
+type OAuthToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// UserInfo is the response of the OpenID Connect userinfo endpoint. The email claims are only
+// released with the email scope.
+type UserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document.
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
 }
@@ -3,15 +3,16 @@ package service
 import (
 	"context"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/sanchey92/jwt-example/internal/config"
 	appError "github.com/sanchey92/jwt-example/internal/errors"
 	"github.com/sanchey92/jwt-example/internal/logger"
+	"github.com/sanchey92/jwt-example/internal/mail"
 	"github.com/sanchey92/jwt-example/internal/models"
 	"github.com/sanchey92/jwt-example/pkg/utils"
 )
@@ -20,121 +21,445 @@ type UserRepository interface {
 	Create(ctx context.Context, user *models.User) error
 	FindByEmail(ctx context.Context, email string) (*models.User, error)
 	FindByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	BumpTokenVersion(ctx context.Context, id uuid.UUID) (int64, error)
+	UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string, updatedAt time.Time) error
+	ChangePassword(ctx context.Context, id uuid.UUID, passwordHash string, keepSessionID uuid.UUID, changedAt time.Time) (int64, error)
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string, resetAt time.Time) error
+	SetEmailVerified(ctx context.Context, id uuid.UUID, verifiedAt time.Time) error
+	SetMFASecret(ctx context.Context, id uuid.UUID, secret string) error
+	EnableMFA(ctx context.Context, id uuid.UUID, enabledAt time.Time, codes []models.RecoveryCode) error
+	UseMFAStep(ctx context.Context, id uuid.UUID, step int64) error
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, usedAt time.Time) error
+	ListUsers(ctx context.Context, filter models.UserFilter) ([]models.User, int, error)
+	SetStatus(ctx context.Context, id uuid.UUID, status models.UserStatus, reason string, changedAt time.Time) error
 }
 
 type TokenRepository interface {
-	SaveToken(ctx context.Context, token *models.RefreshToken) error
-	GetToken(ctx context.Context, token string) (*models.RefreshToken, error)
-	DeleteToken(ctx context.Context, token string) error
+	CreateSession(ctx context.Context, session *models.Session, token *models.RefreshToken) error
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error)
+	DeleteSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	GetToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	RotateToken(ctx context.Context, oldID uuid.UUID, next *models.RefreshToken) error
+	RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error
+	DeleteToken(ctx context.Context, tokenHash string) error
+	DeleteUserTokens(ctx context.Context, userID, exceptFamilyID uuid.UUID) error
+	SaveResetToken(ctx context.Context, token *models.PasswordResetToken) error
+	GetResetToken(ctx context.Context, tokenHash string, now time.Time) (*models.PasswordResetToken, error)
+}
+
+// RoleRepository manages roles, the permissions they grant and their assignment to users.
+type RoleRepository interface {
+	ListRoles(ctx context.Context) ([]models.RoleDefinition, error)
+	CreateRole(ctx context.Context, role *models.RoleDefinition) error
+	DeleteRole(ctx context.Context, name models.Role) error
+	SetRolePermissions(ctx context.Context, name models.Role, permissions []models.Permission) error
+	ListPermissions(ctx context.Context) ([]models.PermissionDefinition, error)
+	AssignRole(ctx context.Context, userID uuid.UUID, role models.Role, at time.Time) error
+	UnassignRole(ctx context.Context, userID uuid.UUID, role models.Role) error
+	SetUserRoles(ctx context.Context, userID uuid.UUID, roles []models.Role, at time.Time) error
+}
+
+// OAuthRepository stores registered OAuth clients and the authorization codes issued to them.
+type OAuthRepository interface {
+	GetOAuthClient(ctx context.Context, clientID string) (*models.OAuthClient, error)
+	ListOAuthClients(ctx context.Context) ([]models.OAuthClient, error)
+	CreateOAuthClient(ctx context.Context, client *models.OAuthClient) error
+	SetOAuthClientSecret(ctx context.Context, clientID, secretHash string) error
+	DeleteOAuthClient(ctx context.Context, clientID string) error
+	SaveAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error
+	UseAuthorizationCode(ctx context.Context, codeHash string, usedAt time.Time) (*models.AuthorizationCode, error)
+}
+
+// RevocationStore is a denylist of access token IDs (jti). Entries are only needed until the token
+// expires, so implementations may drop them after expiresAt.
+type RevocationStore interface {
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// LoginAttemptStore counts failed logins per key, an account or a client IP. RecordLoginFailure
+// increments and returns the counter atomically, ForgiveLoginFailure takes one failure back.
+type LoginAttemptStore interface {
+	GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error)
+	RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (*models.LoginAttempt, error)
+	ForgiveLoginFailure(ctx context.Context, key string) error
+	ResetLoginFailures(ctx context.Context, key string) error
+}
+
+// PasswordHasher hashes new passwords with the configured algorithm and verifies hashes of any
+// supported one. NeedsRehash reports hashes made with another algorithm or weaker parameters.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	NeedsRehash(encoded string) bool
+}
+
+// PasswordPolicy returns the rules a new password breaks, nil when it is acceptable.
+type PasswordPolicy interface {
+	Check(password, email string) ([]string, error)
 }
 
 type AuthService struct {
-	userRepo  UserRepository
-	tokenRepo TokenRepository
-	cfg       *config.Config
-	log       *zap.Logger
+	userRepo    UserRepository
+	tokenRepo   TokenRepository
+	roles       RoleRepository
+	oauth       OAuthRepository
+	revocations RevocationStore
+	attempts    LoginAttemptStore
+	hasher      PasswordHasher
+	policy      PasswordPolicy
+	keys        utils.KeySet
+	mailer      mail.Sender
+	cfg         *config.Config
+	log         *zap.Logger
+
+	dummyHashOnce sync.Once
+	dummyHash     string // hash of a random password, verified against for unknown emails
 }
 
-func NewAuthService(userRepo UserRepository, tokenRepo TokenRepository, cfg *config.Config) *AuthService {
+func NewAuthService(
+	userRepo UserRepository,
+	tokenRepo TokenRepository,
+	roles RoleRepository,
+	oauth OAuthRepository,
+	revocations RevocationStore,
+	attempts LoginAttemptStore,
+	hasher PasswordHasher,
+	policy PasswordPolicy,
+	keys utils.KeySet,
+	mailer mail.Sender,
+	cfg *config.Config,
+) *AuthService {
 	return &AuthService{
-		userRepo:  userRepo,
-		tokenRepo: tokenRepo,
-		cfg:       cfg,
-		log:       logger.GetLogger(),
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		roles:       roles,
+		oauth:       oauth,
+		revocations: revocations,
+		attempts:    attempts,
+		hasher:      hasher,
+		policy:      policy,
+		keys:        keys,
+		mailer:      mailer,
+		cfg:         cfg,
+		log:         logger.GetLogger(),
 	}
 }
 
 func (s *AuthService) Register(ctx context.Context, email, password string) (*models.User, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err := s.checkPasswordPolicy("password", password, email); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.hashPassword(password)
 	if err != nil {
-		s.log.Error("Failed to get hashed password", zap.Error(err))
-		return nil, appError.InternalServer(err)
+		return nil, err
 	}
 
 	user := &models.User{
 		ID:        uuid.New(),
 		Email:     email,
-		Password:  string(hashedPassword),
-		Role:      models.RoleUser,
+		Password:  hashedPassword,
+		Roles:     []models.Role{models.RoleUser},
+		Status:    models.UserStatusActive,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
+	// Without verification the account would be unusable until the link is opened.
+	if s.cfg.RequireEmailVerification {
+		user.Status = models.UserStatusPending
+	}
+
 	if err = s.userRepo.Create(ctx, user); err != nil {
+		if errors.Is(err, appError.ErrUserAlreadyExists) {
+			return nil, appError.Conflict(err)
+		}
 		s.log.Error("Failed to save new user to database", zap.Error(err))
-		return nil, err
+		return nil, appError.InternalServer(err)
 	}
 
+	s.sendVerificationEmail(ctx, user)
+
 	return user, nil
 }
 
-func (s *AuthService) Login(ctx context.Context, email, password string) (*models.TokenPair, error) {
+// Login starts a new session. client carries the UserAgent, IP and Device of the caller. Users with
+// MFA enabled get a challenge instead of a token pair, to be completed with VerifyMFA.
+func (s *AuthService) Login(
+	ctx context.Context,
+	email, password string,
+	client *models.Session,
+) (*models.TokenPair, *models.MFAChallenge, error) {
+	attempt, err := s.checkLoginAllowed(ctx, email, client.IP)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	user, err := s.userRepo.FindByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, appError.ErrUserNotFound) {
-			return nil, appError.Unauthorized(appError.ErrUserNotFound)
+			// Hashing takes as long as for an existing account, so the response time does not tell either.
+			s.verifyDummyPassword(password)
+			return nil, nil, s.loginFailed(attempt, email, client.IP, appError.Unauthorized(appError.ErrInvalidCredentials))
 		}
-		return nil, appError.InternalServer(err)
+		return nil, nil, appError.InternalServer(err)
+	}
+
+	ok, err := s.hasher.Verify(password, user.Password)
+	if err != nil {
+		s.log.Error("Failed to verify password hash", zap.Error(err), zap.String("user_id", user.ID.String()))
+		return nil, nil, appError.InternalServer(appError.ErrInternalServer)
 	}
 
-	if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, appError.Unauthorized(appError.ErrInvalidPassword)
+	if !ok {
+		return nil, nil, s.loginFailed(attempt, email, client.IP, appError.Unauthorized(appError.ErrInvalidCredentials))
 	}
 
-	tokenPair, err := s.generateTokenPair(user)
+	s.rehashPassword(ctx, user, password)
+
+	if err = s.loginSucceeded(ctx, email, client.IP); err != nil {
+		return nil, nil, err
+	}
+
+	if err = checkUserActive(user); err != nil {
+		return nil, nil, err
+	}
+
+	if s.cfg.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		return nil, nil, appError.Forbidden(appError.ErrEmailNotVerified)
+	}
+
+	if user.MFAEnabledAt != nil {
+		return nil, s.newMFAChallenge(user), nil
+	}
+
+	tokenPair, err := s.startSession(ctx, user, client)
 	if err != nil {
-		return nil, appError.InternalServer(err)
+		return nil, nil, err
 	}
 
-	if err = s.saveRefreshToken(ctx, user.ID, tokenPair.RefreshToken); err != nil {
+	return tokenPair, nil, nil
+}
+
+// ListSessions returns the active sessions of the user, marking the one named by currentSessionID.
+func (s *AuthService) ListSessions(ctx context.Context, userID uuid.UUID, currentSessionID string) ([]models.Session, error) {
+	sessions, err := s.tokenRepo.ListSessions(ctx, userID)
+	if err != nil {
 		return nil, appError.InternalServer(err)
 	}
 
-	return tokenPair, nil
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.String() == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession ends one session of the user. Its refresh tokens are deleted and access tokens
+// already issued for it are put on the denylist by session ID.
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	if err := s.tokenRepo.DeleteSession(ctx, userID, sessionID); err != nil {
+		if errors.Is(err, appError.ErrSessionNotFound) {
+			return appError.NotFound(err)
+		}
+		return appError.InternalServer(err)
+	}
+
+	expiresAt := time.Now().Add(time.Duration(s.cfg.AccessTokenTTL) * time.Minute)
+	if err := s.revocations.RevokeAccessToken(ctx, sessionRevocationKey(sessionID.String()), expiresAt); err != nil {
+		return appError.InternalServer(err)
+	}
+
+	return nil
 }
 
-func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
-	return s.tokenRepo.DeleteToken(ctx, refreshToken)
+// Logout revokes the refresh token family and, when given, the access token of the session.
+func (s *AuthService) Logout(ctx context.Context, refreshToken, accessToken string) error {
+	if accessToken != "" {
+		if err := s.RevokeAccessToken(ctx, accessToken); err != nil {
+			return err
+		}
+	}
+
+	storedToken, err := s.findRefreshToken(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, appError.ErrInvalidToken) {
+			return nil
+		}
+		return err
+	}
+
+	return s.tokenRepo.DeleteToken(ctx, storedToken.TokenHash)
+}
+
+// LogoutAll ends every session of the user: refresh tokens are deleted and access tokens issued
+// so far stop being accepted.
+func (s *AuthService) LogoutAll(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.revokeSessions(ctx, userID, uuid.Nil)
+	return err
 }
 
-func (s *AuthService) ExtractUserFromToken(ctx context.Context, tokenStr, secret string) (*models.User, error) {
-	claims, err := utils.ParseToken(tokenStr, secret)
+// LogoutOthers ends every session except the current one. Outstanding access tokens are invalidated
+// by their version, which includes the caller's own, so a fresh access token for the current session
+// is returned.
+func (s *AuthService) LogoutOthers(ctx context.Context, user *models.User, sessionID string) (string, error) {
+	currentID, err := uuid.Parse(sessionID)
 	if err != nil {
-		return nil, err
+		return "", appError.BadRequest(appError.ErrUnknownSession)
+	}
+
+	version, err := s.revokeSessions(ctx, user.ID, currentID)
+	if err != nil {
+		return "", err
+	}
+
+	return s.reissueAccessToken(user, currentID, version)
+}
+
+// RevokeAccessToken puts the token ID on the denylist until the token expires. Tokens that fail
+// verification or are already expired cannot be used anyway and are ignored.
+func (s *AuthService) RevokeAccessToken(ctx context.Context, tokenStr string) error {
+	claims, err := s.ParseAccessToken(tokenStr)
+	if err != nil {
+		return nil
+	}
+
+	if claims.ID == "" {
+		return nil
+	}
+
+	return s.revocations.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// ParseAccessToken checks the signature and registered claims without consulting storage.
+func (s *AuthService) ParseAccessToken(tokenStr string) (*utils.Claims, error) {
+	return utils.ParseToken(tokenStr, s.keys, s.tokenOptions())
+}
+
+func (s *AuthService) ExtractUserFromToken(ctx context.Context, tokenStr string) (*models.User, *utils.Claims, error) {
+	claims, err := s.ParseAccessToken(tokenStr)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	if utils.IsTokenExpired(claims) {
-		return nil, appError.ErrTokenExpired
+		return nil, nil, appError.ErrTokenExpired
+	}
+
+	if err = s.checkRevoked(ctx, claims); err != nil {
+		return nil, nil, err
+	}
+
+	if claims.IsClient() {
+		return nil, nil, appError.ErrClientToken
 	}
 
 	userID, err := utils.ExtractUserID(claims)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	user, err := s.userRepo.FindByID(ctx, userID)
 	if err != nil {
-		return nil, appError.ErrUserNotFound
+		return nil, nil, appError.ErrUserNotFound
 	}
 
-	return user, nil
+	if err = checkUserActive(user); err != nil {
+		return nil, nil, err
+	}
+
+	if claims.TokenVersion != user.TokenVersion {
+		return nil, nil, appError.ErrTokenRevoked
+	}
+
+	return user, claims, nil
 }
 
-func (s *AuthService) ExtractUserFromRefreshToken(
-	ctx context.Context,
-	refreshToken string,
-) (*models.RefreshToken, *models.User, error) {
-	storedToken, err := s.tokenRepo.GetToken(ctx, refreshToken)
-	if err != nil || storedToken == nil {
+// Refresh rotates the refresh token and issues a new token pair. Presenting a token that was already
+// rotated means it leaked: the whole token family is revoked, following the OAuth 2.0 Security BCP.
+// Only within a short grace period after the rotation it is taken for a parallel request of the same
+// client instead, see refreshRotated.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, *models.User, error) {
+	storedToken, err := s.findRefreshToken(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, appError.ErrInvalidToken) {
+			return nil, nil, appError.Unauthorized(appError.ErrInvalidToken)
+		}
+		return nil, nil, appError.InternalServer(err)
+	}
+
+	if storedToken.RevokedAt != nil {
 		return nil, nil, appError.Unauthorized(appError.ErrInvalidToken)
 	}
 
+	if storedToken.RotatedAt != nil {
+		return s.refreshRotated(ctx, storedToken)
+	}
+
+	if s.IsRefreshTokenExpired(storedToken) {
+		return nil, nil, appError.Unauthorized(appError.ErrTokenExpired)
+	}
+
 	user, err := s.userRepo.FindByID(ctx, storedToken.UserID)
 	if err != nil {
 		return nil, nil, appError.Unauthorized(appError.ErrUserNotFound)
 	}
 
-	return storedToken, user, nil
+	if err = checkUserActive(user); err != nil {
+		return nil, nil, err
+	}
+
+	tokenPair, err := s.generateTokenPair(user, storedToken.FamilyID)
+	if err != nil {
+		return nil, nil, appError.InternalServer(err)
+	}
+
+	next := s.newRefreshToken(user.ID, storedToken.FamilyID, tokenPair.RefreshToken)
+
+	if err = s.tokenRepo.RotateToken(ctx, storedToken.ID, next); err != nil {
+		if !errors.Is(err, appError.ErrTokenReused) {
+			return nil, nil, appError.InternalServer(err)
+		}
+
+		// Another request rotated or revoked the token since it was read.
+		if storedToken, err = s.tokenRepo.GetToken(ctx, storedToken.TokenHash); err != nil {
+			return nil, nil, appError.Unauthorized(appError.ErrInvalidToken)
+		}
+		if storedToken.RevokedAt != nil || storedToken.RotatedAt == nil {
+			return nil, nil, appError.Unauthorized(appError.ErrInvalidToken)
+		}
+		return s.refreshRotated(ctx, storedToken)
+	}
+
+	return tokenPair, user, nil
+}
+
+// refreshRotated handles a token presented again after its rotation. Browsers send parallel requests
+// with the same cookie, so within RefreshTokenReuseGrace the token still gets an access token for its
+// session, but no refresh token: the successor went out with the response to the request that rotated
+// it. Later presentations are reuse.
+func (s *AuthService) refreshRotated(ctx context.Context, token *models.RefreshToken) (*models.TokenPair, *models.User, error) {
+	grace := time.Duration(s.cfg.RefreshTokenReuseGrace) * time.Second
+	if time.Since(*token.RotatedAt) > grace {
+		return nil, nil, s.handleTokenReuse(ctx, token)
+	}
+
+	user, err := s.userRepo.FindByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, appError.Unauthorized(appError.ErrUserNotFound)
+	}
+
+	if err = checkUserActive(user); err != nil {
+		return nil, nil, err
+	}
+
+	accessToken, err := s.GenerateAccessToken(user, token.FamilyID)
+	if err != nil {
+		return nil, nil, appError.InternalServer(err)
+	}
+
+	return &models.TokenPair{AccessToken: accessToken}, user, nil
 }
 
 func (s *AuthService) IsRefreshTokenExpired(token *models.RefreshToken) bool {
@@ -145,25 +470,45 @@ func (s *AuthService) IsRefreshTokenExpired(token *models.RefreshToken) bool {
 	return false
 }
 
-func (s *AuthService) GetNewRefreshToken(ctx context.Context, userID uuid.UUID, tokenStr string) (string, error) {
-	if err := s.tokenRepo.DeleteToken(ctx, tokenStr); err != nil {
-		return "", err
-	}
+// GenerateAccessToken issues an access token bound to the session (refresh token family).
+func (s *AuthService) GenerateAccessToken(user *models.User, sessionID uuid.UUID) (string, error) {
+	claims := utils.NewClaims(user, s.cfg.AccessTokenTTL, s.tokenOptions())
+	claims.SessionID = sessionID.String()
 
-	newRefreshToken, err := utils.GenerateRefreshToken(32)
+	return s.keys.Sign(claims)
+}
+
+// startSession creates the session of a fully authenticated user and its first token pair.
+func (s *AuthService) startSession(ctx context.Context, user *models.User, client *models.Session) (*models.TokenPair, error) {
+	sessionID := uuid.New()
+
+	tokenPair, err := s.generateTokenPair(user, sessionID)
 	if err != nil {
-		return "", err
+		return nil, appError.InternalServer(err)
 	}
 
-	if err = s.saveRefreshToken(ctx, userID, newRefreshToken); err != nil {
-		return "", err
+	now := time.Now()
+	session := &models.Session{
+		ID:         sessionID,
+		UserID:     user.ID,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		Device:     client.Device,
+		CreatedAt:  now,
+		LastUsedAt: now,
 	}
 
-	return newRefreshToken, nil
+	refreshToken := s.newRefreshToken(user.ID, sessionID, tokenPair.RefreshToken)
+
+	if err = s.tokenRepo.CreateSession(ctx, session, refreshToken); err != nil {
+		return nil, appError.InternalServer(err)
+	}
+
+	return tokenPair, nil
 }
 
-func (s *AuthService) generateTokenPair(user *models.User) (*models.TokenPair, error) {
-	accessToken, err := utils.GenerateJWTToken(user, s.cfg.AccessTokenTTL, s.cfg.JWTAccessSecret)
+func (s *AuthService) generateTokenPair(user *models.User, sessionID uuid.UUID) (*models.TokenPair, error) {
+	accessToken, err := s.GenerateAccessToken(user, sessionID)
 	if err != nil {
 		return nil, err
 	}
@@ -179,16 +524,145 @@ func (s *AuthService) generateTokenPair(user *models.User) (*models.TokenPair, e
 	}, nil
 }
 
-func (s *AuthService) saveRefreshToken(ctx context.Context, userID uuid.UUID, token string) error {
-	refreshToken := &models.RefreshToken{
+// checkPasswordPolicy reports policy violations as errors of the named input field.
+func (s *AuthService) checkPasswordPolicy(field, password, email string) error {
+	violations, err := s.policy.Check(password, email)
+	if err != nil {
+		s.log.Error("Failed to check password policy", zap.Error(err))
+		return appError.InternalServer(appError.ErrInternalServer)
+	}
+
+	if len(violations) > 0 {
+		return appError.ValidationFailed(map[string][]string{field: violations})
+	}
+
+	return nil
+}
+
+func (s *AuthService) hashPassword(password string) (string, error) {
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		s.log.Error("Failed to get hashed password", zap.Error(err))
+		return "", appError.InternalServer(err)
+	}
+
+	return hashedPassword, nil
+}
+
+// rehashPassword upgrades a hash made with an outdated algorithm or parameters while the plaintext
+// is at hand. Failing to do so only postpones the upgrade to the next login.
+func (s *AuthService) rehashPassword(ctx context.Context, user *models.User, password string) {
+	if !s.hasher.NeedsRehash(user.Password) {
+		return
+	}
+
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		s.log.Error("Failed to rehash password", zap.Error(err), zap.String("user_id", user.ID.String()))
+		return
+	}
+
+	if err = s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword, time.Now()); err != nil {
+		s.log.Error("Failed to save rehashed password", zap.Error(err), zap.String("user_id", user.ID.String()))
+		return
+	}
+
+	user.Password = hashedPassword
+}
+
+func (s *AuthService) tokenOptions() utils.TokenOptions {
+	return utils.TokenOptions{
+		Issuer:   s.cfg.JWTIssuer,
+		Audience: s.cfg.JWTAudience,
+		Leeway:   time.Duration(s.cfg.JWTLeeway) * time.Second,
+	}
+}
+
+func (s *AuthService) newRefreshToken(userID, familyID uuid.UUID, token string) *models.RefreshToken {
+	now := time.Now()
+
+	return &models.RefreshToken{
 		ID:        uuid.New(),
 		UserID:    userID,
-		Token:     token,
-		ExpiresAt: time.Now().Add(time.Duration(s.cfg.RefreshTokenTTL) * 24 * time.Hour),
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(token, s.cfg.JWTRefreshSecret),
+		ExpiresAt: now.Add(time.Duration(s.cfg.RefreshTokenTTL) * 24 * time.Hour),
+		CreatedAt: now,
 	}
+}
 
-	if err := s.tokenRepo.SaveToken(ctx, refreshToken); err != nil {
-		return err
+// checkRevoked consults the denylist for the token ID and for the session the token belongs to.
+func (s *AuthService) checkRevoked(ctx context.Context, claims *utils.Claims) error {
+	keys := []string{claims.ID}
+	if claims.SessionID != "" {
+		keys = append(keys, sessionRevocationKey(claims.SessionID))
 	}
+
+	for _, key := range keys {
+		revoked, err := s.revocations.IsAccessTokenRevoked(ctx, key)
+		if err != nil {
+			s.log.Error("Failed to check access token revocation", zap.Error(err))
+			return appError.ErrInternalServer
+		}
+
+		if revoked {
+			return appError.ErrTokenRevoked
+		}
+	}
+
 	return nil
 }
+
+// sessionRevocationKey shares the denylist with token IDs, which are UUIDs and never carry the prefix.
+func sessionRevocationKey(sessionID string) string {
+	return "sid:" + sessionID
+}
+
+// revokeSessions deletes the user's refresh tokens except the kept family and rejects every access
+// token issued so far by bumping the token version, which it returns.
+func (s *AuthService) revokeSessions(ctx context.Context, userID, keepFamilyID uuid.UUID) (int64, error) {
+	if err := s.tokenRepo.DeleteUserTokens(ctx, userID, keepFamilyID); err != nil {
+		return 0, appError.InternalServer(err)
+	}
+
+	version, err := s.userRepo.BumpTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, appError.InternalServer(err)
+	}
+
+	return version, nil
+}
+
+// reissueAccessToken issues an access token for the kept session after revokeSessions, carrying
+// the new token version.
+func (s *AuthService) reissueAccessToken(user *models.User, sessionID uuid.UUID, version int64) (string, error) {
+	current := *user
+	current.TokenVersion = version
+
+	accessToken, err := s.GenerateAccessToken(&current, sessionID)
+	if err != nil {
+		return "", appError.InternalServer(err)
+	}
+
+	return accessToken, nil
+}
+
+// findRefreshToken looks the token up by its hash, only hashes are stored.
+func (s *AuthService) findRefreshToken(ctx context.Context, token string) (*models.RefreshToken, error) {
+	return s.tokenRepo.GetToken(ctx, utils.HashToken(token, s.cfg.JWTRefreshSecret))
+}
+
+func (s *AuthService) handleTokenReuse(ctx context.Context, token *models.RefreshToken) error {
+	s.log.Warn("Security event: refresh token reuse detected, revoking token family",
+		zap.String("event", "refresh_token_reuse"),
+		zap.String("user_id", token.UserID.String()),
+		zap.String("family_id", token.FamilyID.String()),
+		zap.String("token_id", token.ID.String()))
+
+	if err := s.tokenRepo.RevokeTokenFamily(ctx, token.FamilyID); err != nil {
+		s.log.Error("Failed to revoke token family", zap.Error(err), zap.String("family_id", token.FamilyID.String()))
+		return appError.InternalServer(err)
+	}
+
+	return appError.Unauthorized(appError.ErrTokenReused)
+}
@@ -2,24 +2,38 @@ package service
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/sanchey92/jwt-example/internal/config"
 	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/mail"
 	"github.com/sanchey92/jwt-example/internal/models"
 	"github.com/sanchey92/jwt-example/internal/service/mocks"
+	"github.com/sanchey92/jwt-example/internal/storage/memory"
+	"github.com/sanchey92/jwt-example/pkg/password"
+	"github.com/sanchey92/jwt-example/pkg/utils"
 )
 
 const (
-	testEmail    = "test@example.com"
-	testPassword = "password123"
+	testEmail         = "test@example.com"
+	testPassword      = "password123"
+	testRefreshToken  = "refresh-token"
+	testRefreshSecret = "refresh-secret"
 )
 
+var testRefreshHash = utils.HashToken(testRefreshToken, testRefreshSecret)
+
 func TestAuthService_Register(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -39,7 +53,8 @@ func TestAuthService_Register(t *testing.T) {
 						assert.Equal(t, testEmail, user.Email)
 						assert.NotEmpty(t, user.ID)
 						assert.NotEmpty(t, user.Password)
-						assert.Equal(t, models.RoleUser, user.Role)
+						assert.Equal(t, []models.Role{models.RoleUser}, user.Roles)
+						assert.Equal(t, models.UserStatusActive, user.Status)
 						assert.WithinDuration(t, time.Now(), user.CreatedAt, time.Second)
 						assert.WithinDuration(t, time.Now(), user.UpdatedAt, time.Second)
 						return nil
@@ -58,6 +73,17 @@ func TestAuthService_Register(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name:     "password rejected by policy",
+			email:    testEmail,
+			password: "short",
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().
+					Create(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			wantErr: true,
+		},
 		{
 			name:     "password hashing failure",
 			email:    testEmail,
@@ -78,7 +104,7 @@ func TestAuthService_Register(t *testing.T) {
 
 			mockRepo := mocks.NewMockUserRepository(ctrl)
 
-			s := newTestAuthService(mockRepo)
+			s := newTestAuthService(mockRepo, nil)
 
 			tt.mockUserRepo(mockRepo)
 
@@ -99,9 +125,463 @@ func TestAuthService_Register(t *testing.T) {
 	}
 }
 
-func newTestAuthService(repo UserRepository) *AuthService {
+func TestAuthService_Refresh(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Email: testEmail, Roles: []models.Role{models.RoleUser}}
+	familyID := uuid.New()
+	rotatedAt := time.Now().Add(-time.Minute)
+
+	activeToken := func() *models.RefreshToken {
+		return &models.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			FamilyID:  familyID,
+			TokenHash: testRefreshHash,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+	}
+
+	tests := []struct {
+		name           string
+		mock           func(u *mocks.MockUserRepository, tr *mocks.MockTokenRepository)
+		wantErr        error
+		wantAccessOnly bool
+	}{
+		{
+			name: "rotates token within family",
+			mock: func(u *mocks.MockUserRepository, tr *mocks.MockTokenRepository) {
+				stored := activeToken()
+				tr.EXPECT().GetToken(gomock.Any(), testRefreshHash).Return(stored, nil)
+				u.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+				tr.EXPECT().
+					RotateToken(gomock.Any(), stored.ID, gomock.Any()).
+					DoAndReturn(func(ctx context.Context, oldID uuid.UUID, next *models.RefreshToken) error {
+						assert.Equal(t, familyID, next.FamilyID)
+						assert.Equal(t, user.ID, next.UserID)
+						assert.NotEqual(t, testRefreshHash, next.TokenHash)
+						assert.Len(t, next.TokenHash, 64)
+						return nil
+					})
+			},
+		},
+		{
+			name: "reuse of rotated token revokes family",
+			mock: func(u *mocks.MockUserRepository, tr *mocks.MockTokenRepository) {
+				stored := activeToken()
+				stored.RotatedAt = &rotatedAt
+				tr.EXPECT().GetToken(gomock.Any(), testRefreshHash).Return(stored, nil)
+				tr.EXPECT().RevokeTokenFamily(gomock.Any(), familyID).Return(nil)
+			},
+			wantErr: appError.ErrTokenReused,
+		},
+		{
+			name: "token rotated moments ago gets an access token only",
+			mock: func(u *mocks.MockUserRepository, tr *mocks.MockTokenRepository) {
+				justRotated := time.Now().Add(-time.Second)
+				stored := activeToken()
+				stored.RotatedAt = &justRotated
+				tr.EXPECT().GetToken(gomock.Any(), testRefreshHash).Return(stored, nil)
+				u.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+			},
+			wantAccessOnly: true,
+		},
+		{
+			name: "concurrent rotation gets an access token only",
+			mock: func(u *mocks.MockUserRepository, tr *mocks.MockTokenRepository) {
+				justRotated := time.Now()
+				rotated := activeToken()
+				rotated.RotatedAt = &justRotated
+				tr.EXPECT().GetToken(gomock.Any(), testRefreshHash).Return(activeToken(), nil)
+				u.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil).Times(2)
+				tr.EXPECT().RotateToken(gomock.Any(), gomock.Any(), gomock.Any()).Return(appError.ErrTokenReused)
+				tr.EXPECT().GetToken(gomock.Any(), testRefreshHash).Return(rotated, nil)
+			},
+			wantAccessOnly: true,
+		},
+		{
+			name: "concurrent revocation",
+			mock: func(u *mocks.MockUserRepository, tr *mocks.MockTokenRepository) {
+				revokedAt := time.Now()
+				revoked := activeToken()
+				revoked.RevokedAt = &revokedAt
+				tr.EXPECT().GetToken(gomock.Any(), testRefreshHash).Return(activeToken(), nil)
+				u.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+				tr.EXPECT().RotateToken(gomock.Any(), gomock.Any(), gomock.Any()).Return(appError.ErrTokenReused)
+				tr.EXPECT().GetToken(gomock.Any(), testRefreshHash).Return(revoked, nil)
+			},
+			wantErr: appError.ErrInvalidToken,
+		},
+		{
+			name: "expired token",
+			mock: func(u *mocks.MockUserRepository, tr *mocks.MockTokenRepository) {
+				stored := activeToken()
+				stored.ExpiresAt = time.Now().Add(-time.Minute)
+				tr.EXPECT().GetToken(gomock.Any(), testRefreshHash).Return(stored, nil)
+			},
+			wantErr: appError.ErrTokenExpired,
+		},
+		{
+			name: "unknown token",
+			mock: func(u *mocks.MockUserRepository, tr *mocks.MockTokenRepository) {
+				tr.EXPECT().GetToken(gomock.Any(), testRefreshHash).Return(nil, appError.ErrInvalidToken)
+			},
+			wantErr: appError.ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			tokenRepo := mocks.NewMockTokenRepository(ctrl)
+			tt.mock(userRepo, tokenRepo)
+
+			s := newTestAuthService(userRepo, tokenRepo)
+
+			tokenPair, gotUser, err := s.Refresh(context.Background(), testRefreshToken)
+
+			if tt.wantErr != nil {
+				assert.Error(t, err)
+				assert.Equal(t, tt.wantErr.Error(), err.Error())
+				assert.Nil(t, tokenPair)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, user, gotUser)
+			assert.NotEmpty(t, tokenPair.AccessToken)
+			assert.Equal(t, tt.wantAccessOnly, tokenPair.RefreshToken == "")
+		})
+	}
+}
+
+func TestAuthService_ExtractUserFromToken(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Email: testEmail, Roles: []models.Role{models.RoleUser}}
+
+	loggedOut := *user
+	loggedOut.TokenVersion = 1
+
+	tests := []struct {
+		name    string
+		revoked bool
+		stored  *models.User
+		wantErr error
+	}{
+		{
+			name:   "valid token",
+			stored: user,
+		},
+		{
+			name:    "revoked token",
+			revoked: true,
+			wantErr: appError.ErrTokenRevoked,
+		},
+		{
+			name:    "issued before logout from all devices",
+			stored:  &loggedOut,
+			wantErr: appError.ErrTokenRevoked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			revocations := mocks.NewMockRevocationStore(ctrl)
+
+			s := newTestAuthService(userRepo, nil)
+			s.revocations = revocations
+
+			token, err := s.GenerateAccessToken(user, uuid.New())
+			assert.NoError(t, err)
+
+			revocations.EXPECT().IsAccessTokenRevoked(gomock.Any(), gomock.Any()).Return(tt.revoked, nil).MinTimes(1)
+			if tt.stored != nil {
+				userRepo.EXPECT().FindByID(gomock.Any(), user.ID).Return(tt.stored, nil)
+			}
+
+			got, _, err := s.ExtractUserFromToken(context.Background(), token)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, got)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, user, got)
+		})
+	}
+}
+
+func TestAuthService_Logout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := &models.User{ID: uuid.New(), Roles: []models.Role{models.RoleUser}}
+	tokenRepo := mocks.NewMockTokenRepository(ctrl)
+	revocations := mocks.NewMockRevocationStore(ctrl)
+
+	s := newTestAuthService(nil, tokenRepo)
+	s.revocations = revocations
+
+	accessToken, err := s.GenerateAccessToken(user, uuid.New())
+	assert.NoError(t, err)
+
+	revocations.EXPECT().
+		RevokeAccessToken(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, jti string, expiresAt time.Time) error {
+			assert.NotEmpty(t, jti)
+			assert.WithinDuration(t, time.Now().Add(15*time.Minute), expiresAt, time.Minute)
+			return nil
+		})
+	tokenRepo.EXPECT().
+		GetToken(gomock.Any(), testRefreshHash).
+		Return(&models.RefreshToken{ID: uuid.New(), TokenHash: testRefreshHash}, nil)
+	tokenRepo.EXPECT().DeleteToken(gomock.Any(), testRefreshHash).Return(nil)
+
+	assert.NoError(t, s.Logout(context.Background(), testRefreshToken, accessToken))
+}
+
+func TestAuthService_LogoutOthers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := &models.User{ID: uuid.New(), Roles: []models.Role{models.RoleUser}}
+	sessionID := uuid.New()
+
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	tokenRepo := mocks.NewMockTokenRepository(ctrl)
+	s := newTestAuthService(userRepo, tokenRepo)
+
+	tokenRepo.EXPECT().DeleteUserTokens(gomock.Any(), user.ID, sessionID).Return(nil)
+	userRepo.EXPECT().BumpTokenVersion(gomock.Any(), user.ID).Return(int64(3), nil)
+
+	start := time.Now()
+	accessToken, err := s.LogoutOthers(context.Background(), user, sessionID.String())
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "the new token is issued without waiting")
+
+	claims, err := s.ParseAccessToken(accessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, sessionID.String(), claims.SessionID)
+	assert.Equal(t, int64(3), claims.TokenVersion, "the new token must carry the new version")
+	assert.Zero(t, user.TokenVersion, "the user of the request is left alone")
+
+	_, err = s.LogoutOthers(context.Background(), user, "")
+	assert.Error(t, err)
+}
+
+func TestAuthService_LongPasswordWithBcrypt(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	long := strings.Repeat("a", 100)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(long[:password.BcryptMaxBytes]), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := &models.User{ID: uuid.New(), Email: testEmail, Password: string(hash), Roles: []models.Role{models.RoleUser}}
+
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	s := newTestAuthService(userRepo, nil)
+	s.attempts = newUnlimitedAttempts(ctrl)
+	s.policy = &password.Policy{MinLength: 8, MaxLength: 128, MaxBytes: password.BcryptMaxBytes}
+
+	_, err = s.Register(context.Background(), testEmail, long)
+
+	var apiErr *appError.ApiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, map[string][]string{"password": {"must be at most 72 bytes long"}}, apiErr.Fields)
+
+	// A hash of the first 72 bytes must not match the longer password, nor may checking it fail.
+	userRepo.EXPECT().FindByEmail(gomock.Any(), testEmail).Return(user, nil)
+
+	_, _, err = s.Login(context.Background(), testEmail, long, &models.Session{})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+}
+
+// countingHasher counts the password checks made through it.
+type countingHasher struct {
+	PasswordHasher
+	verified int
+}
+
+func (h *countingHasher) Verify(password, encoded string) (bool, error) {
+	h.verified++
+	return h.PasswordHasher.Verify(password, encoded)
+}
+
+func TestAuthService_LoginUnknownEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := &models.User{ID: uuid.New(), Email: testEmail, Password: string(hash)}
+
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	userRepo.EXPECT().FindByEmail(gomock.Any(), testEmail).Return(user, nil)
+	userRepo.EXPECT().FindByEmail(gomock.Any(), "nobody@example.com").Return(nil, appError.ErrUserNotFound).Times(2)
+
+	s := newTestAuthService(userRepo, nil)
+	s.attempts = newUnlimitedAttempts(ctrl)
+	hasher := &countingHasher{PasswordHasher: s.hasher}
+	s.hasher = hasher
+
+	_, _, wrongPassword := s.Login(context.Background(), testEmail, "wrong-password", &models.Session{})
+	_, _, unknownEmail := s.Login(context.Background(), "nobody@example.com", "wrong-password", &models.Session{})
+
+	var apiErr *appError.ApiError
+	require.ErrorAs(t, unknownEmail, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, wrongPassword.Error(), unknownEmail.Error())
+	assert.Equal(t, 2, hasher.verified, "unknown emails are hashed like known ones")
+
+	_, _, err = s.Login(context.Background(), "nobody@example.com", testPassword, &models.Session{})
+	assert.EqualError(t, err, appError.ErrInvalidCredentials.Error())
+	assert.Equal(t, 3, hasher.verified)
+}
+
+func TestAuthService_Login(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	user := &models.User{ID: uuid.New(), Email: testEmail, Password: string(hash), Roles: []models.Role{models.RoleUser}}
+	client := &models.Session{UserAgent: "curl/8.4.0", IP: "127.0.0.1", Device: "curl"}
+
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	tokenRepo := mocks.NewMockTokenRepository(ctrl)
+	s := newTestAuthService(userRepo, tokenRepo)
+	s.attempts = newUnlimitedAttempts(ctrl)
+
+	userRepo.EXPECT().FindByEmail(gomock.Any(), testEmail).Return(user, nil).Times(2)
+	tokenRepo.EXPECT().
+		CreateSession(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, session *models.Session, token *models.RefreshToken) error {
+			assert.Equal(t, user.ID, session.UserID)
+			assert.Equal(t, client.IP, session.IP)
+			assert.Equal(t, client.Device, session.Device)
+			assert.Equal(t, session.ID, token.FamilyID)
+			return nil
+		})
+
+	tokenPair, challenge, err := s.Login(context.Background(), testEmail, testPassword, client)
+	assert.NoError(t, err)
+	assert.Nil(t, challenge)
+
+	claims, err := s.ParseAccessToken(tokenPair.AccessToken)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, claims.SessionID)
+
+	_, _, err = s.Login(context.Background(), testEmail, "wrong-password", client)
+	assert.EqualError(t, err, appError.ErrInvalidCredentials.Error())
+
+	s.cfg.RequireEmailVerification = true
+	userRepo.EXPECT().FindByEmail(gomock.Any(), testEmail).Return(user, nil)
+
+	_, _, err = s.Login(context.Background(), testEmail, testPassword, client)
+	var apiErr *appError.ApiError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+}
+
+func TestAuthService_LoginRehashesPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	user := &models.User{ID: uuid.New(), Email: testEmail, Password: string(hash), Roles: []models.Role{models.RoleUser}}
+
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	tokenRepo := mocks.NewMockTokenRepository(ctrl)
+	s := newTestAuthService(userRepo, tokenRepo)
+	s.attempts = newUnlimitedAttempts(ctrl)
+	s.hasher = password.NewArgon2id(password.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1})
+
+	userRepo.EXPECT().FindByEmail(gomock.Any(), testEmail).Return(user, nil)
+	userRepo.EXPECT().
+		UpdatePassword(gomock.Any(), user.ID, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id uuid.UUID, hash string, updatedAt time.Time) error {
+			assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"), hash)
+			return nil
+		})
+	tokenRepo.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+	_, _, err = s.Login(context.Background(), testEmail, testPassword, &models.Session{})
+	assert.NoError(t, err)
+	assert.False(t, s.hasher.NeedsRehash(user.Password))
+}
+
+func TestAuthService_RevokeSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	tokenRepo := mocks.NewMockTokenRepository(ctrl)
+	revocations := mocks.NewMockRevocationStore(ctrl)
+	s := newTestAuthService(nil, tokenRepo)
+	s.revocations = revocations
+
+	tokenRepo.EXPECT().DeleteSession(gomock.Any(), userID, sessionID).Return(nil)
+	revocations.EXPECT().RevokeAccessToken(gomock.Any(), "sid:"+sessionID.String(), gomock.Any()).Return(nil)
+
+	assert.NoError(t, s.RevokeSession(context.Background(), userID, sessionID))
+
+	tokenRepo.EXPECT().DeleteSession(gomock.Any(), userID, sessionID).Return(appError.ErrSessionNotFound)
+
+	err := s.RevokeSession(context.Background(), userID, sessionID)
+	var apiErr *appError.ApiError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
+
+// newUnlimitedAttempts never locks anything.
+func newUnlimitedAttempts(ctrl *gomock.Controller) *mocks.MockLoginAttemptStore {
+	attempts := mocks.NewMockLoginAttemptStore(ctrl)
+	attempts.EXPECT().GetLoginAttempt(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	attempts.EXPECT().
+		RecordLoginFailure(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&models.LoginAttempt{Failures: 1}, nil).
+		AnyTimes()
+	attempts.EXPECT().ForgiveLoginFailure(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	attempts.EXPECT().ResetLoginFailures(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	return attempts
+}
+
+func newTestAuthService(userRepo UserRepository, tokenRepo TokenRepository) *AuthService {
 	return &AuthService{
-		userRepo: repo,
-		log:      zap.NewNop(),
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		revocations: memory.NewRevocationStore(),
+		keys:        utils.NewHMACKey("test-secret"),
+		hasher:      password.NewBcrypt(bcrypt.MinCost),
+		policy:      &password.Policy{MinLength: 8, MaxLength: 128, DisallowEmail: true},
+		mailer:      mail.NewWriterSender(io.Discard),
+		cfg: &config.Config{
+			JWTSigningAlg:          utils.AlgHS256,
+			JWTRefreshSecret:       testRefreshSecret,
+			AccessTokenTTL:         15,
+			RefreshTokenTTL:        7,
+			LoginMaxFailures:       5,
+			MFAMaxFailures:         5,
+			RefreshTokenReuseGrace: 30,
+			LoginLockoutBase:       30,
+			LoginLockoutMax:        60,
+		},
+		log: zap.NewNop(),
 	}
 }
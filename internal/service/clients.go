@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+func (s *AuthService) ListOAuthClients(ctx context.Context) ([]models.OAuthClient, error) {
+	clients, err := s.oauth.ListOAuthClients(ctx)
+	if err != nil {
+		return nil, appError.InternalServer(err)
+	}
+
+	return clients, nil
+}
+
+func (s *AuthService) GetOAuthClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	client, err := s.oauth.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		return nil, clientError(err)
+	}
+
+	return client, nil
+}
+
+// CreateOAuthClient registers the client under a new ID. Confidential clients get a secret, which
+// is returned once and stored only as a hash.
+func (s *AuthService) CreateOAuthClient(ctx context.Context, client *models.OAuthClient) (string, error) {
+	if err := checkOAuthClient(client); err != nil {
+		return "", err
+	}
+
+	client.ID = uuid.NewString()
+	client.CreatedAt = time.Now()
+
+	var secret string
+	if client.Confidential {
+		var err error
+		if secret, client.SecretHash, err = s.newClientSecret(); err != nil {
+			return "", appError.InternalServer(err)
+		}
+	}
+
+	if err := s.oauth.CreateOAuthClient(ctx, client); err != nil {
+		return "", appError.InternalServer(err)
+	}
+
+	s.log.Info("OAuth client registered", zap.String("client_id", client.ID), zap.Strings("grant_types", client.GrantTypes))
+
+	return secret, nil
+}
+
+// RotateOAuthClientSecret replaces the secret of a confidential client. The old secret stops working
+// at once; access tokens already issued stay valid until they expire.
+func (s *AuthService) RotateOAuthClientSecret(ctx context.Context, clientID string) (string, error) {
+	client, err := s.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+
+	if !client.Confidential {
+		return "", appError.Conflict(appError.ErrPublicClient)
+	}
+
+	secret, secretHash, err := s.newClientSecret()
+	if err != nil {
+		return "", appError.InternalServer(err)
+	}
+
+	if err = s.oauth.SetOAuthClientSecret(ctx, clientID, secretHash); err != nil {
+		return "", clientError(err)
+	}
+
+	s.log.Info("OAuth client secret rotated", zap.String("client_id", clientID))
+
+	return secret, nil
+}
+
+// DeleteOAuthClient removes the client. Its own access tokens are refused from now on, because every
+// request with one looks the client up.
+func (s *AuthService) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	if err := s.oauth.DeleteOAuthClient(ctx, clientID); err != nil {
+		return clientError(err)
+	}
+
+	s.log.Info("OAuth client deleted", zap.String("client_id", clientID))
+
+	return nil
+}
+
+// ExtractClientFromToken authenticates a service calling with a client_credentials token. Tokens of
+// users, including those issued to a client on their behalf, are refused.
+func (s *AuthService) ExtractClientFromToken(ctx context.Context, tokenStr string) (*models.OAuthClient, *utils.Claims, error) {
+	claims, err := s.ParseAccessToken(tokenStr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if utils.IsTokenExpired(claims) {
+		return nil, nil, appError.ErrTokenExpired
+	}
+
+	if err = s.checkRevoked(ctx, claims); err != nil {
+		return nil, nil, err
+	}
+
+	if !claims.IsClient() {
+		return nil, nil, appError.ErrNotClientToken
+	}
+
+	client, err := s.oauth.GetOAuthClient(ctx, claims.ClientID)
+	if err != nil {
+		if errors.Is(err, appError.ErrOAuthClientNotFound) {
+			return nil, nil, err
+		}
+		return nil, nil, appError.InternalServer(err)
+	}
+
+	if !client.AllowsGrant(models.GrantTypeClientCredentials) {
+		return nil, nil, appError.ErrNotClientToken
+	}
+
+	return client, claims, nil
+}
+
+func (s *AuthService) newClientSecret() (string, string, error) {
+	secret, err := utils.GenerateRefreshToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, utils.HashToken(secret, s.cfg.JWTRefreshSecret), nil
+}
+
+// checkOAuthClient validates a client registration: the authorization code flow needs redirect
+// URIs, client_credentials a confidential client, and scopes must be valid RFC 6749 scope tokens.
+func checkOAuthClient(client *models.OAuthClient) error {
+	fields := make(map[string][]string)
+
+	for _, grantType := range client.GrantTypes {
+		if grantType != models.GrantTypeAuthorizationCode && grantType != models.GrantTypeClientCredentials {
+			fields["grant_types"] = append(fields["grant_types"], "unsupported grant type "+grantType)
+		}
+	}
+
+	if client.AllowsGrant(models.GrantTypeAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		fields["redirect_uris"] = append(fields["redirect_uris"], "required for authorization_code")
+	}
+
+	for _, redirectURI := range client.RedirectURIs {
+		u, err := url.Parse(redirectURI)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			fields["redirect_uris"] = append(fields["redirect_uris"], "must be an absolute URI without fragment")
+			break
+		}
+	}
+
+	if client.AllowsGrant(models.GrantTypeClientCredentials) && !client.Confidential {
+		fields["confidential"] = append(fields["confidential"], "required for client_credentials")
+	}
+
+	if slices.ContainsFunc(client.Scopes, func(scope string) bool {
+		return scope == "" || strings.ContainsAny(scope, " \"\\")
+	}) {
+		fields["scopes"] = append(fields["scopes"], "must not contain spaces, quotes or backslashes")
+	}
+
+	if len(fields) > 0 {
+		return appError.ValidationFailed(fields)
+	}
+
+	return nil
+}
+
+// clientError classifies errors of the OAuth client repository.
+func clientError(err error) error {
+	if errors.Is(err, appError.ErrOAuthClientNotFound) {
+		return appError.NotFound(err)
+	}
+	return appError.InternalServer(err)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/internal/service/mocks"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+func TestAuthService_CreateOAuthClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		client     models.OAuthClient
+		wantSecret bool
+		wantFields []string
+	}{
+		{
+			name: "confidential service client",
+			client: models.OAuthClient{
+				Name:         "nightly reports",
+				Scopes:       []string{"reports:read"},
+				GrantTypes:   []string{models.GrantTypeClientCredentials},
+				Confidential: true,
+			},
+			wantSecret: true,
+		},
+		{
+			name: "public web client",
+			client: models.OAuthClient{
+				Name:         "web",
+				RedirectURIs: []string{testRedirectURI},
+				GrantTypes:   []string{models.GrantTypeAuthorizationCode},
+			},
+		},
+		{
+			name: "client credentials need a secret",
+			client: models.OAuthClient{
+				Name:       "nightly reports",
+				GrantTypes: []string{models.GrantTypeClientCredentials},
+			},
+			wantFields: []string{"confidential"},
+		},
+		{
+			name: "authorization code needs redirect uris",
+			client: models.OAuthClient{
+				Name:       "web",
+				Scopes:     []string{"two words"},
+				GrantTypes: []string{models.GrantTypeAuthorizationCode, "password"},
+			},
+			wantFields: []string{"grant_types", "redirect_uris", "scopes"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			oauth := mocks.NewMockOAuthRepository(ctrl)
+			if tt.wantFields == nil {
+				oauth.EXPECT().CreateOAuthClient(gomock.Any(), gomock.Any()).Return(nil)
+			}
+
+			s := newTestAuthService(nil, nil)
+			s.oauth = oauth
+
+			client := tt.client
+			secret, err := s.CreateOAuthClient(context.Background(), &client)
+			if tt.wantFields != nil {
+				var apiErr *appError.ApiError
+				require.ErrorAs(t, err, &apiErr)
+				assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+				for _, field := range tt.wantFields {
+					assert.Contains(t, apiErr.Fields, field)
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NoError(t, uuid.Validate(client.ID))
+
+			if !tt.wantSecret {
+				assert.Empty(t, secret)
+				assert.Empty(t, client.SecretHash)
+				return
+			}
+
+			assert.NotEmpty(t, secret)
+			assert.Equal(t, utils.HashToken(secret, testRefreshSecret), client.SecretHash)
+		})
+	}
+}
+
+func TestAuthService_ExtractClientFromToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := &models.OAuthClient{ID: "batch", GrantTypes: []string{models.GrantTypeClientCredentials}}
+
+	oauth := mocks.NewMockOAuthRepository(ctrl)
+	oauth.EXPECT().GetOAuthClient(gomock.Any(), "batch").Return(client, nil)
+
+	revocations := mocks.NewMockRevocationStore(ctrl)
+	revocations.EXPECT().IsAccessTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+
+	s := newTestAuthService(nil, nil)
+	s.oauth = oauth
+	s.revocations = revocations
+
+	clientToken, err := s.keys.Sign(utils.NewClientClaims("batch", "reports:read", 15, s.tokenOptions()))
+	require.NoError(t, err)
+
+	got, claims, err := s.ExtractClientFromToken(context.Background(), clientToken)
+	require.NoError(t, err)
+	assert.Equal(t, client, got)
+	assert.True(t, claims.HasScope("reports:read"))
+
+	_, _, err = s.ExtractUserFromToken(context.Background(), clientToken)
+	assert.ErrorIs(t, err, appError.ErrClientToken)
+
+	userToken, err := s.GenerateAccessToken(&models.User{ID: uuid.New()}, uuid.New())
+	require.NoError(t, err)
+
+	_, _, err = s.ExtractClientFromToken(context.Background(), userToken)
+	assert.ErrorIs(t, err, appError.ErrNotClientToken)
+
+	oauth.EXPECT().GetOAuthClient(gomock.Any(), "batch").Return(nil, appError.ErrOAuthClientNotFound)
+
+	_, _, err = s.ExtractClientFromToken(context.Background(), clientToken)
+	assert.ErrorIs(t, err, appError.ErrOAuthClientNotFound)
+
+	oauth.EXPECT().GetOAuthClient(gomock.Any(), "batch").Return(nil, errors.New("connection refused"))
+
+	_, _, err = s.ExtractClientFromToken(context.Background(), clientToken)
+	var apiErr *appError.ApiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+// UnlockUser clears the failed logins and two-factor codes of the account, lifting its lockout.
+func (s *AuthService) UnlockUser(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, appError.ErrUserNotFound) {
+			return appError.NotFound(err)
+		}
+		return appError.InternalServer(err)
+	}
+
+	for _, key := range []string{accountAttemptKey(user.Email), mfaAttemptKey(user.ID)} {
+		if err = s.attempts.ResetLoginFailures(ctx, key); err != nil {
+			return appError.InternalServer(err)
+		}
+	}
+
+	s.log.Info("Account unlocked", zap.String("user_id", user.ID.String()))
+
+	return nil
+}
+
+// checkLoginAllowed refuses the attempt while the client IP or the account is locked. A locked
+// account is refused before its password is checked, so guessing cannot continue during lockout.
+// Otherwise the attempt is counted as failed up front and loginSucceeded takes it back; it returns
+// the counter of the account.
+func (s *AuthService) checkLoginAllowed(ctx context.Context, email, ip string) (*models.LoginAttempt, error) {
+	if ip != "" {
+		_, wait, err := s.beginAttempt(ctx, ipAttemptKey(ip), s.cfg.LoginMaxIPFailures)
+		if err != nil {
+			return nil, err
+		}
+
+		if wait > 0 {
+			return nil, appError.TooManyRequests(appError.ErrTooManyAttempts, wait)
+		}
+	}
+
+	attempt, wait, err := s.beginAttempt(ctx, accountAttemptKey(email), s.cfg.LoginMaxFailures)
+	if err != nil {
+		return nil, err
+	}
+
+	if wait > 0 {
+		return nil, appError.Locked(appError.ErrAccountLocked, wait)
+	}
+
+	return attempt, nil
+}
+
+// beginAttempt counts an attempt for the key unless the key is locked, and returns how long the
+// key stays locked. The counter is incremented and read in one statement: attempts that passed the
+// lockout check in parallel see each other in the returned counter and are refused once the earlier
+// ones would have reached the threshold, as if those had already failed.
+func (s *AuthService) beginAttempt(ctx context.Context, key string, threshold int) (*models.LoginAttempt, time.Duration, error) {
+	now := time.Now()
+
+	seen, err := s.attempts.GetLoginAttempt(ctx, key)
+	if err != nil {
+		return nil, 0, appError.InternalServer(err)
+	}
+
+	if wait := s.lockedFor(seen, threshold, now); wait > 0 {
+		return nil, wait, nil
+	}
+
+	attempt, err := s.attempts.RecordLoginFailure(ctx, key, now, s.lockoutResetBefore(now))
+	if err != nil {
+		return nil, 0, appError.InternalServer(err)
+	}
+
+	seenFailures := 0
+	if seen != nil {
+		seenFailures = seen.Failures
+	}
+
+	if attempt.Failures-1 > seenFailures {
+		earlier := &models.LoginAttempt{Key: key, Failures: attempt.Failures - 1, LastFailureAt: now}
+		return attempt, s.lockedFor(earlier, threshold, now), nil
+	}
+
+	return attempt, 0, nil
+}
+
+// loginSucceeded takes back the attempts counted by checkLoginAllowed. The account starts over,
+// the client IP only gets its one attempt back, so logging into an own account does not reset it.
+func (s *AuthService) loginSucceeded(ctx context.Context, email, ip string) error {
+	if ip != "" {
+		if err := s.attempts.ForgiveLoginFailure(ctx, ipAttemptKey(ip)); err != nil {
+			return appError.InternalServer(err)
+		}
+	}
+
+	if err := s.attempts.ResetLoginFailures(ctx, accountAttemptKey(email)); err != nil {
+		return appError.InternalServer(err)
+	}
+
+	return nil
+}
+
+// loginFailed returns err for a wrong email or password, the failure was already counted by
+// checkLoginAllowed. Unknown emails are counted like existing ones and Login answers them with the
+// same error after the same hashing work, so neither lockouts nor responses reveal which accounts
+// exist.
+func (s *AuthService) loginFailed(attempt *models.LoginAttempt, email, ip string, err error) error {
+	if s.cfg.LoginMaxFailures > 0 && attempt.Failures >= s.cfg.LoginMaxFailures {
+		s.log.Warn("Security event: account locked after failed logins",
+			zap.String("event", "account_locked"),
+			zap.String("email", email),
+			zap.String("ip", ip),
+			zap.Int("failures", attempt.Failures),
+			zap.Duration("locked_for", s.lockedFor(attempt, s.cfg.LoginMaxFailures, time.Now())))
+	}
+
+	return err
+}
+
+// verifyDummyPassword checks the password against a hash made with the configured hasher, as if the
+// unknown email belonged to an account. The hash is created on first use.
+func (s *AuthService) verifyDummyPassword(password string) {
+	s.dummyHashOnce.Do(func() {
+		secret, err := utils.GenerateRefreshToken(32)
+		if err == nil {
+			s.dummyHash, err = s.hasher.Hash(secret)
+		}
+		if err != nil {
+			s.log.Error("Failed to create the dummy password hash", zap.Error(err))
+		}
+	})
+
+	if s.dummyHash != "" {
+		_, _ = s.hasher.Verify(password, s.dummyHash)
+	}
+}
+
+// lockoutResetBefore returns when failures have to be made to still count, older ones are forgotten.
+func (s *AuthService) lockoutResetBefore(now time.Time) time.Time {
+	return now.Add(-time.Duration(s.cfg.LoginLockoutMax) * time.Minute)
+}
+
+// lockedFor returns how long the key stays locked. Reaching the threshold locks for LoginLockoutBase,
+// each further failure doubles the delay up to LoginLockoutMax.
+func (s *AuthService) lockedFor(attempt *models.LoginAttempt, threshold int, now time.Time) time.Duration {
+	if attempt == nil || threshold == 0 || attempt.Failures < threshold {
+		return 0
+	}
+
+	maxDelay := time.Duration(s.cfg.LoginLockoutMax) * time.Minute
+	delay := time.Duration(s.cfg.LoginLockoutBase) * time.Second
+
+	for i := threshold; i < attempt.Failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	return attempt.LastFailureAt.Add(delay).Sub(now)
+}
+
+func accountAttemptKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+// ipAttemptKey counts by host only, every connection of a client comes from another port.
+func ipAttemptKey(ip string) string {
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return "ip:" + ip
+}
+
+func mfaAttemptKey(userID uuid.UUID) string {
+	return "mfa:" + userID.String()
+}
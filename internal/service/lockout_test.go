@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sanchey92/jwt-example/internal/config"
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/internal/service/mocks"
+)
+
+const testIP = "203.0.113.7"
+
+func TestAuthService_LoginLockout(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := &models.User{ID: uuid.New(), Email: testEmail, Password: string(hash), Roles: []models.Role{models.RoleUser}}
+
+	tests := []struct {
+		name         string
+		password     string
+		mockAttempts func(m *mocks.MockLoginAttemptStore)
+		mockUserRepo func(m *mocks.MockUserRepository)
+		wantStatus   int
+	}{
+		{
+			name:     "locked account refuses correct password",
+			password: testPassword,
+			mockAttempts: func(m *mocks.MockLoginAttemptStore) {
+				m.EXPECT().GetLoginAttempt(gomock.Any(), "ip:"+testIP).Return(nil, nil)
+				m.EXPECT().
+					RecordLoginFailure(gomock.Any(), "ip:"+testIP, gomock.Any(), gomock.Any()).
+					Return(&models.LoginAttempt{Failures: 1}, nil)
+				m.EXPECT().
+					GetLoginAttempt(gomock.Any(), "account:"+testEmail).
+					Return(&models.LoginAttempt{Failures: 5, LastFailureAt: time.Now()}, nil)
+			},
+			mockUserRepo: func(m *mocks.MockUserRepository) {},
+			wantStatus:   http.StatusLocked,
+		},
+		{
+			name:     "locked ip",
+			password: testPassword,
+			mockAttempts: func(m *mocks.MockLoginAttemptStore) {
+				m.EXPECT().
+					GetLoginAttempt(gomock.Any(), "ip:"+testIP).
+					Return(&models.LoginAttempt{Failures: 20, LastFailureAt: time.Now()}, nil)
+			},
+			mockUserRepo: func(m *mocks.MockUserRepository) {},
+			wantStatus:   http.StatusTooManyRequests,
+		},
+		{
+			name:     "parallel attempts past the threshold",
+			password: testPassword,
+			mockAttempts: func(m *mocks.MockLoginAttemptStore) {
+				m.EXPECT().GetLoginAttempt(gomock.Any(), "ip:"+testIP).Return(nil, nil)
+				m.EXPECT().
+					RecordLoginFailure(gomock.Any(), "ip:"+testIP, gomock.Any(), gomock.Any()).
+					Return(&models.LoginAttempt{Failures: 1}, nil)
+				m.EXPECT().
+					GetLoginAttempt(gomock.Any(), "account:"+testEmail).
+					Return(&models.LoginAttempt{Failures: 3, LastFailureAt: time.Now()}, nil)
+				m.EXPECT().
+					RecordLoginFailure(gomock.Any(), "account:"+testEmail, gomock.Any(), gomock.Any()).
+					Return(&models.LoginAttempt{Failures: 6, LastFailureAt: time.Now()}, nil)
+			},
+			mockUserRepo: func(m *mocks.MockUserRepository) {},
+			wantStatus:   http.StatusLocked,
+		},
+		{
+			name:     "expired lockout",
+			password: testPassword,
+			mockAttempts: func(m *mocks.MockLoginAttemptStore) {
+				m.EXPECT().GetLoginAttempt(gomock.Any(), "ip:"+testIP).Return(nil, nil)
+				m.EXPECT().
+					RecordLoginFailure(gomock.Any(), "ip:"+testIP, gomock.Any(), gomock.Any()).
+					Return(&models.LoginAttempt{Failures: 1}, nil)
+				m.EXPECT().
+					GetLoginAttempt(gomock.Any(), "account:"+testEmail).
+					Return(&models.LoginAttempt{Failures: 5, LastFailureAt: time.Now().Add(-time.Minute)}, nil)
+				m.EXPECT().
+					RecordLoginFailure(gomock.Any(), "account:"+testEmail, gomock.Any(), gomock.Any()).
+					Return(&models.LoginAttempt{Failures: 6, LastFailureAt: time.Now()}, nil)
+				m.EXPECT().ForgiveLoginFailure(gomock.Any(), "ip:"+testIP).Return(nil)
+				m.EXPECT().ResetLoginFailures(gomock.Any(), "account:"+testEmail).Return(nil)
+			},
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByEmail(gomock.Any(), testEmail).Return(user, nil)
+			},
+		},
+		{
+			name:     "wrong password stays counted",
+			password: "wrong-password",
+			mockAttempts: func(m *mocks.MockLoginAttemptStore) {
+				m.EXPECT().GetLoginAttempt(gomock.Any(), gomock.Any()).Return(nil, nil).Times(2)
+				m.EXPECT().
+					RecordLoginFailure(gomock.Any(), "ip:"+testIP, gomock.Any(), gomock.Any()).
+					Return(&models.LoginAttempt{Failures: 1}, nil)
+				m.EXPECT().
+					RecordLoginFailure(gomock.Any(), "account:"+testEmail, gomock.Any(), gomock.Any()).
+					Return(&models.LoginAttempt{Failures: 1, LastFailureAt: time.Now()}, nil)
+			},
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByEmail(gomock.Any(), testEmail).Return(user, nil)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:     "unknown email stays counted",
+			password: testPassword,
+			mockAttempts: func(m *mocks.MockLoginAttemptStore) {
+				m.EXPECT().GetLoginAttempt(gomock.Any(), gomock.Any()).Return(nil, nil).Times(2)
+				m.EXPECT().
+					RecordLoginFailure(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(&models.LoginAttempt{Failures: 1}, nil).
+					Times(2)
+			},
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByEmail(gomock.Any(), testEmail).Return(nil, appError.ErrUserNotFound)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			tokenRepo := mocks.NewMockTokenRepository(ctrl)
+			attempts := mocks.NewMockLoginAttemptStore(ctrl)
+			tt.mockUserRepo(userRepo)
+			tt.mockAttempts(attempts)
+			tokenRepo.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+			s := newTestAuthService(userRepo, tokenRepo)
+			s.attempts = attempts
+			s.cfg.LoginMaxIPFailures = 20
+
+			_, _, err := s.Login(context.Background(), testEmail, tt.password, &models.Session{IP: testIP})
+			if tt.wantStatus == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var apiErr *appError.ApiError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.wantStatus, apiErr.StatusCode)
+			if tt.wantStatus != http.StatusUnauthorized {
+				assert.Positive(t, apiErr.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestAuthService_LockedFor(t *testing.T) {
+	s := &AuthService{cfg: &config.Config{LoginLockoutBase: 30, LoginLockoutMax: 10}}
+	now := time.Now()
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 4, want: 0},
+		{failures: 5, want: 30 * time.Second},
+		{failures: 6, want: time.Minute},
+		{failures: 8, want: 4 * time.Minute},
+		{failures: 50, want: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		attempt := &models.LoginAttempt{Failures: tt.failures, LastFailureAt: now}
+		assert.Equal(t, tt.want, s.lockedFor(attempt, 5, now), "failures %d", tt.failures)
+	}
+
+	assert.Zero(t, s.lockedFor(&models.LoginAttempt{Failures: 50, LastFailureAt: now}, 0, now), "disabled")
+}
+
+func TestIPAttemptKey(t *testing.T) {
+	assert.Equal(t, "ip:"+testIP, ipAttemptKey(testIP))
+	assert.Equal(t, "ip:"+testIP, ipAttemptKey(testIP+":52314"))
+	assert.Equal(t, "ip:2001:db8::1", ipAttemptKey("[2001:db8::1]:52314"))
+	assert.Equal(t, "ip:2001:db8::1", ipAttemptKey("2001:db8::1"))
+}
+
+func TestAuthService_UnlockUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userID := uuid.New()
+
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	attempts := mocks.NewMockLoginAttemptStore(ctrl)
+	s := newTestAuthService(userRepo, nil)
+	s.attempts = attempts
+
+	userRepo.EXPECT().FindByID(gomock.Any(), userID).Return(&models.User{ID: userID, Email: "Test@Example.com"}, nil)
+	attempts.EXPECT().ResetLoginFailures(gomock.Any(), "account:"+testEmail).Return(nil)
+	attempts.EXPECT().ResetLoginFailures(gomock.Any(), "mfa:"+userID.String()).Return(nil)
+
+	assert.NoError(t, s.UnlockUser(context.Background(), userID))
+
+	userRepo.EXPECT().FindByID(gomock.Any(), userID).Return(nil, appError.ErrUserNotFound)
+
+	err := s.UnlockUser(context.Background(), userID)
+	var apiErr *appError.ApiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/pkg/totp"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+const (
+	mfaChallengePurpose = "mfa-challenge"
+	mfaChallengeTTL     = 5 * time.Minute
+	recoveryCodeCount   = 10
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollMFA generates a new TOTP secret for the user. MFA stays disabled until ConfirmMFA proves
+// that the authenticator app was set up; enrolling again before that replaces the secret.
+func (s *AuthService) EnrollMFA(ctx context.Context, user *models.User) (*models.MFAEnrollment, error) {
+	if user.MFAEnabledAt != nil {
+		return nil, appError.BadRequest(appError.ErrMFAAlreadyEnabled)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, appError.InternalServer(err)
+	}
+
+	if err = s.userRepo.SetMFASecret(ctx, user.ID, secret); err != nil {
+		if errors.Is(err, appError.ErrMFAAlreadyEnabled) {
+			return nil, appError.BadRequest(err)
+		}
+		return nil, appError.InternalServer(err)
+	}
+
+	return &models.MFAEnrollment{
+		Secret: secret,
+		URI:    totp.URI(secret, s.cfg.MFAIssuer, user.Email),
+	}, nil
+}
+
+// ConfirmMFA enables MFA when the code matches the enrolled secret and returns the recovery codes.
+// Only their hashes are stored, so this is the only time the user sees them.
+func (s *AuthService) ConfirmMFA(ctx context.Context, user *models.User, code string) ([]string, error) {
+	if user.MFAEnabledAt != nil {
+		return nil, appError.BadRequest(appError.ErrMFAAlreadyEnabled)
+	}
+
+	if user.MFASecret == "" {
+		return nil, appError.BadRequest(appError.ErrMFANotEnrolled)
+	}
+
+	if err := s.verifyTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	codes := make([]string, recoveryCodeCount)
+	stored := make([]models.RecoveryCode, recoveryCodeCount)
+
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, appError.InternalServer(err)
+		}
+
+		codes[i] = code
+		stored[i] = models.RecoveryCode{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			CodeHash:  s.hashRecoveryCode(code),
+			CreatedAt: now,
+		}
+	}
+
+	if err := s.userRepo.EnableMFA(ctx, user.ID, now, stored); err != nil {
+		if errors.Is(err, appError.ErrMFAAlreadyEnabled) {
+			return nil, appError.BadRequest(err)
+		}
+		return nil, appError.InternalServer(err)
+	}
+
+	s.log.Info("MFA enabled", zap.String("user_id", user.ID.String()))
+
+	return codes, nil
+}
+
+// VerifyMFA completes a login started with Login. code is either the current TOTP code or one of
+// the recovery codes. The challenge is used up by a successful login; codes are counted per user
+// like logins and MFAMaxFailures wrong ones burn the challenge and lock further attempts.
+func (s *AuthService) VerifyMFA(ctx context.Context, mfaToken, code string, client *models.Session) (*models.TokenPair, error) {
+	userID, challengeID, err := s.parseMFAChallenge(mfaToken)
+	if err != nil {
+		return nil, appError.Unauthorized(err)
+	}
+
+	used, err := s.revocations.IsAccessTokenRevoked(ctx, mfaChallengeRevocationKey(challengeID))
+	if err != nil {
+		return nil, appError.InternalServer(err)
+	}
+	if used {
+		return nil, appError.Unauthorized(appError.ErrInvalidToken)
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, appError.ErrUserNotFound) {
+			return nil, appError.Unauthorized(appError.ErrInvalidToken)
+		}
+		return nil, appError.InternalServer(err)
+	}
+
+	if err = checkUserActive(user); err != nil {
+		return nil, err
+	}
+
+	if user.MFAEnabledAt == nil {
+		return nil, appError.Unauthorized(appError.ErrMFANotEnrolled)
+	}
+
+	attempt, wait, err := s.beginAttempt(ctx, mfaAttemptKey(user.ID), s.cfg.MFAMaxFailures)
+	if err != nil {
+		return nil, err
+	}
+
+	if wait > 0 {
+		return nil, appError.TooManyRequests(appError.ErrTooManyAttempts, wait)
+	}
+
+	if isTOTPCode(code) {
+		err = s.verifyTOTP(ctx, user, code)
+	} else {
+		err = s.useRecoveryCode(ctx, user, code)
+	}
+	if err != nil {
+		var apiErr *appError.ApiError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+			return nil, s.mfaFailed(ctx, attempt, user, challengeID, err)
+		}
+		return nil, err
+	}
+
+	if err = s.useMFAChallenge(ctx, challengeID); err != nil {
+		return nil, err
+	}
+
+	if err = s.attempts.ResetLoginFailures(ctx, mfaAttemptKey(user.ID)); err != nil {
+		return nil, appError.InternalServer(err)
+	}
+
+	return s.startSession(ctx, user, client)
+}
+
+// mfaFailed handles a wrong code, already counted by beginAttempt. The failure that reaches
+// MFAMaxFailures also burns the challenge, so the user has to sign in with the password again once
+// the lockout is over.
+func (s *AuthService) mfaFailed(
+	ctx context.Context,
+	attempt *models.LoginAttempt,
+	user *models.User,
+	challengeID string,
+	cause error,
+) error {
+	wait := s.lockedFor(attempt, s.cfg.MFAMaxFailures, time.Now())
+	if wait <= 0 {
+		return cause
+	}
+
+	if err := s.useMFAChallenge(ctx, challengeID); err != nil {
+		return err
+	}
+
+	s.log.Warn("Security event: two-factor login locked after failed codes",
+		zap.String("event", "mfa_locked"),
+		zap.String("user_id", user.ID.String()),
+		zap.Int("failures", attempt.Failures),
+		zap.Duration("locked_for", wait))
+
+	return appError.TooManyRequests(appError.ErrTooManyAttempts, wait)
+}
+
+func (s *AuthService) newMFAChallenge(user *models.User) *models.MFAChallenge {
+	expiresAt := time.Now().Add(mfaChallengeTTL)
+	subject := strings.Join([]string{mfaChallengePurpose, user.ID.String(), uuid.NewString()}, "|")
+
+	return &models.MFAChallenge{
+		Token:     utils.SignToken(subject, expiresAt, s.cfg.JWTRefreshSecret),
+		ExpiresAt: expiresAt,
+	}
+}
+
+// parseMFAChallenge returns the user and the ID of a challenge issued by newMFAChallenge.
+func (s *AuthService) parseMFAChallenge(mfaToken string) (uuid.UUID, string, error) {
+	subject, err := utils.VerifySignedToken(mfaToken, s.cfg.JWTRefreshSecret)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	parts := strings.Split(subject, "|")
+	if len(parts) != 3 || parts[0] != mfaChallengePurpose || parts[2] == "" {
+		return uuid.Nil, "", appError.ErrInvalidToken
+	}
+
+	userID, err := uuid.Parse(parts[1])
+	if err != nil {
+		return uuid.Nil, "", appError.ErrInvalidToken
+	}
+
+	return userID, parts[2], nil
+}
+
+// useMFAChallenge puts the challenge on the denylist until it would have expired anyway.
+func (s *AuthService) useMFAChallenge(ctx context.Context, challengeID string) error {
+	err := s.revocations.RevokeAccessToken(ctx, mfaChallengeRevocationKey(challengeID), time.Now().Add(mfaChallengeTTL))
+	if err != nil {
+		return appError.InternalServer(err)
+	}
+	return nil
+}
+
+// mfaChallengeRevocationKey shares the denylist with token IDs, which are UUIDs and never carry the prefix.
+func mfaChallengeRevocationKey(challengeID string) string {
+	return "mfa:" + challengeID
+}
+
+// verifyTOTP accepts each time step once per user, so a code seen by someone else is useless.
+func (s *AuthService) verifyTOTP(ctx context.Context, user *models.User, code string) error {
+	step, ok := totp.Validate(user.MFASecret, code, time.Now())
+	if !ok {
+		return appError.Unauthorized(appError.ErrInvalidMFACode)
+	}
+
+	if err := s.userRepo.UseMFAStep(ctx, user.ID, step); err != nil {
+		if errors.Is(err, appError.ErrMFACodeReused) {
+			return appError.Unauthorized(err)
+		}
+		return appError.InternalServer(err)
+	}
+
+	return nil
+}
+
+func (s *AuthService) useRecoveryCode(ctx context.Context, user *models.User, code string) error {
+	err := s.userRepo.UseRecoveryCode(ctx, user.ID, s.hashRecoveryCode(code), time.Now())
+	if err != nil {
+		if errors.Is(err, appError.ErrInvalidMFACode) {
+			return appError.Unauthorized(err)
+		}
+		return appError.InternalServer(err)
+	}
+
+	s.log.Warn("Security event: MFA recovery code used",
+		zap.String("event", "mfa_recovery_code_used"),
+		zap.String("user_id", user.ID.String()))
+
+	return nil
+}
+
+// hashRecoveryCode ignores case and separators, so codes can be typed as they are read.
+func (s *AuthService) hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return utils.HashToken(normalized, s.cfg.JWTRefreshSecret)
+}
+
+// generateRecoveryCode returns 50 random bits formatted as xxxxx-xxxxx.
+func generateRecoveryCode() (string, error) {
+	raw := make([]byte, 7)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(raw))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/internal/service/mocks"
+	"github.com/sanchey92/jwt-example/pkg/totp"
+)
+
+func TestAuthService_EnrollAndConfirmMFA(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := &models.User{ID: uuid.New(), Email: testEmail}
+
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	s := newTestAuthService(userRepo, nil)
+	s.cfg.MFAIssuer = "jwt-example"
+
+	userRepo.EXPECT().SetMFASecret(gomock.Any(), user.ID, gomock.Any()).Return(nil)
+
+	enrollment, err := s.EnrollMFA(context.Background(), user)
+	require.NoError(t, err)
+	assert.NotEmpty(t, enrollment.Secret)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/jwt-example:test@example.com?")
+
+	user.MFASecret = enrollment.Secret
+
+	_, err = s.ConfirmMFA(context.Background(), user, "000000")
+	assert.Error(t, err)
+
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+
+	userRepo.EXPECT().UseMFAStep(gomock.Any(), user.ID, gomock.Any()).Return(nil)
+	userRepo.EXPECT().
+		EnableMFA(gomock.Any(), user.ID, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id uuid.UUID, enabledAt time.Time, codes []models.RecoveryCode) error {
+			assert.Len(t, codes, recoveryCodeCount)
+			return nil
+		})
+
+	codes, err := s.ConfirmMFA(context.Background(), user, code)
+	require.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+
+	enabledAt := time.Now()
+	user.MFAEnabledAt = &enabledAt
+
+	_, err = s.EnrollMFA(context.Background(), user)
+	assert.ErrorContains(t, err, appError.ErrMFAAlreadyEnabled.Error())
+}
+
+func TestAuthService_LoginWithMFA(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	enabledAt := time.Now()
+	user := &models.User{
+		ID:           uuid.New(),
+		Email:        testEmail,
+		Password:     string(hash),
+		Roles:        []models.Role{models.RoleAdmin},
+		MFASecret:    secret,
+		MFAEnabledAt: &enabledAt,
+	}
+	client := &models.Session{UserAgent: "curl/8.4.0", IP: "127.0.0.1", Device: "curl"}
+
+	validCode, err := totp.Code(secret, time.Now())
+	require.NoError(t, err)
+	staleCode, err := totp.Code(secret, time.Now().Add(-10*totp.Period))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		code          string
+		mockUserRepo  func(m *mocks.MockUserRepository)
+		mockTokenRepo func(m *mocks.MockTokenRepository)
+		wantStatus    int
+	}{
+		{
+			name: "valid totp code",
+			code: validCode,
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().UseMFAStep(gomock.Any(), user.ID, totp.Step(time.Now())).Return(nil)
+			},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {
+				m.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name: "replayed totp code",
+			code: validCode,
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().UseMFAStep(gomock.Any(), user.ID, gomock.Any()).Return(appError.ErrMFACodeReused)
+			},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {},
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "stale totp code",
+			code:          staleCode,
+			mockUserRepo:  func(m *mocks.MockUserRepository) {},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {},
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name: "recovery code",
+			code: "ABCDE-FGHIJ",
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().UseRecoveryCode(gomock.Any(), user.ID, gomock.Any(), gomock.Any()).Return(nil)
+			},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {
+				m.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name: "used recovery code",
+			code: "abcde-fghij",
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().UseRecoveryCode(gomock.Any(), user.ID, gomock.Any(), gomock.Any()).Return(appError.ErrInvalidMFACode)
+			},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {},
+			wantStatus:    http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			tokenRepo := mocks.NewMockTokenRepository(ctrl)
+			s := newTestAuthService(userRepo, tokenRepo)
+			s.attempts = newUnlimitedAttempts(ctrl)
+
+			userRepo.EXPECT().FindByEmail(gomock.Any(), testEmail).Return(user, nil)
+
+			tokenPair, challenge, err := s.Login(context.Background(), testEmail, testPassword, client)
+			require.NoError(t, err)
+			assert.Nil(t, tokenPair)
+			require.NotNil(t, challenge)
+
+			userRepo.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+			tt.mockUserRepo(userRepo)
+			tt.mockTokenRepo(tokenRepo)
+
+			tokenPair, err = s.VerifyMFA(context.Background(), challenge.Token, tt.code, client)
+			if tt.wantStatus == 0 {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, tokenPair.AccessToken)
+				return
+			}
+
+			var apiErr *appError.ApiError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.wantStatus, apiErr.StatusCode)
+		})
+	}
+}
+
+func TestAuthService_VerifyMFAInvalidChallenge(t *testing.T) {
+	s := newTestAuthService(nil, nil)
+
+	_, err := s.VerifyMFA(context.Background(), "forged.token", "123456", &models.Session{})
+
+	var apiErr *appError.ApiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+}
+
+func TestAuthService_VerifyMFAChallengeIsSingleUse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := newTestMFAUser(t)
+	client := &models.Session{UserAgent: "curl/8.4.0"}
+
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	tokenRepo := mocks.NewMockTokenRepository(ctrl)
+	s := newTestAuthService(userRepo, tokenRepo)
+	s.attempts = newUnlimitedAttempts(ctrl)
+
+	challenge := s.newMFAChallenge(user)
+
+	userRepo.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+	userRepo.EXPECT().UseRecoveryCode(gomock.Any(), user.ID, gomock.Any(), gomock.Any()).Return(nil)
+	tokenRepo.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+	_, err := s.VerifyMFA(context.Background(), challenge.Token, "abcde-fghij", client)
+	require.NoError(t, err)
+
+	_, err = s.VerifyMFA(context.Background(), challenge.Token, "klmno-pqrst", client)
+
+	var apiErr *appError.ApiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, appError.ErrInvalidToken.Error(), apiErr.Message)
+}
+
+func TestAuthService_VerifyMFALockout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := newTestMFAUser(t)
+	client := &models.Session{UserAgent: "curl/8.4.0"}
+
+	var failures int
+	attempts := mocks.NewMockLoginAttemptStore(ctrl)
+	attempts.EXPECT().
+		GetLoginAttempt(gomock.Any(), "mfa:"+user.ID.String()).
+		DoAndReturn(func(ctx context.Context, key string) (*models.LoginAttempt, error) {
+			return &models.LoginAttempt{Key: key, Failures: failures, LastFailureAt: time.Now()}, nil
+		}).
+		AnyTimes()
+	attempts.EXPECT().
+		RecordLoginFailure(gomock.Any(), "mfa:"+user.ID.String(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, key string, at, resetBefore time.Time) (*models.LoginAttempt, error) {
+			failures++
+			return &models.LoginAttempt{Key: key, Failures: failures, LastFailureAt: at}, nil
+		}).
+		Times(5)
+
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	userRepo.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil).AnyTimes()
+	userRepo.EXPECT().
+		UseRecoveryCode(gomock.Any(), user.ID, gomock.Any(), gomock.Any()).
+		Return(appError.ErrInvalidMFACode).
+		Times(5)
+
+	s := newTestAuthService(userRepo, nil)
+	s.attempts = attempts
+
+	challenge := s.newMFAChallenge(user)
+
+	for i := 1; i < 5; i++ {
+		_, err := s.VerifyMFA(context.Background(), challenge.Token, "wrong-code", client)
+
+		var apiErr *appError.ApiError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode, "attempt %d", i)
+	}
+
+	_, err := s.VerifyMFA(context.Background(), challenge.Token, "wrong-code", client)
+
+	var apiErr *appError.ApiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	assert.InDelta(t, 30*time.Second, apiErr.RetryAfter, float64(time.Second))
+
+	// The challenge is burned, a fresh one from a new login still has to wait for the lockout.
+	_, err = s.VerifyMFA(context.Background(), challenge.Token, "wrong-code", client)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+
+	_, err = s.VerifyMFA(context.Background(), s.newMFAChallenge(user).Token, "wrong-code", client)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+}
+
+func newTestMFAUser(t *testing.T) *models.User {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+
+	enabledAt := time.Now()
+	return &models.User{ID: uuid.New(), Email: testEmail, MFASecret: secret, MFAEnabledAt: &enabledAt}
+}
@@ -0,0 +1,357 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+const (
+	ResponseTypeCode = "code"
+	PKCEMethodS256   = "S256"
+)
+
+// AuthorizeRequest validates an authorization request and describes it for the consent screen.
+// Errors that cannot be reported to the client carry no Location, the others redirect back to it.
+func (s *AuthService) AuthorizeRequest(
+	ctx context.Context,
+	req *models.AuthorizationRequest,
+) (*models.AuthorizationConsent, error) {
+	client, redirectURI, scopes, err := s.checkAuthorizationRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthorizationConsent{
+		ClientID:    client.ID,
+		ClientName:  client.Name,
+		RedirectURI: redirectURI,
+		Scopes:      scopes,
+		State:       req.State,
+	}, nil
+}
+
+// ApproveAuthorization records the decision of the user and returns where to send the user back
+// to: with a single-use code when approved, with access_denied otherwise. sessionID names the
+// session the user approved from, its start is the auth_time of the ID token.
+func (s *AuthService) ApproveAuthorization(
+	ctx context.Context,
+	user *models.User,
+	sessionID string,
+	req *models.AuthorizationRequest,
+	approved bool,
+) (string, error) {
+	client, redirectURI, scopes, err := s.checkAuthorizationRequest(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	if !approved {
+		return redirectWithParams(redirectURI, url.Values{
+			"error":             {"access_denied"},
+			"error_description": {"the user denied the request"},
+		}, req.State), nil
+	}
+
+	authTime, err := s.sessionAuthTime(ctx, user.ID, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := utils.GenerateRefreshToken(32)
+	if err != nil {
+		return "", appError.InternalServer(err)
+	}
+
+	now := time.Now()
+	authCode := &models.AuthorizationCode{
+		CodeHash:      utils.HashToken(code, s.cfg.JWTRefreshSecret),
+		ClientID:      client.ID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		AuthTime:      authTime,
+		ExpiresAt:     now.Add(time.Duration(s.cfg.OAuthCodeTTL) * time.Second),
+		CreatedAt:     now,
+	}
+
+	if err = s.oauth.SaveAuthorizationCode(ctx, authCode); err != nil {
+		return "", appError.InternalServer(err)
+	}
+
+	s.log.Info("Authorization code issued",
+		zap.String("user_id", user.ID.String()),
+		zap.String("client_id", client.ID),
+	)
+
+	return redirectWithParams(redirectURI, url.Values{"code": {code}}, req.State), nil
+}
+
+// ExchangeToken is the token endpoint. It authenticates the client and issues an access token for
+// the authorization_code or the client_credentials grant, plus an ID token when openid was granted.
+func (s *AuthService) ExchangeToken(ctx context.Context, req *models.TokenRequest) (*models.OAuthToken, error) {
+	switch req.GrantType {
+	case "":
+		return nil, appError.OAuthError(http.StatusBadRequest, "invalid_request", "grant_type is required")
+	case models.GrantTypeAuthorizationCode, models.GrantTypeClientCredentials:
+	default:
+		return nil, appError.OAuthError(http.StatusBadRequest, "unsupported_grant_type", "grant type is not supported")
+	}
+
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.AllowsGrant(req.GrantType) {
+		return nil, appError.OAuthError(http.StatusBadRequest, "unauthorized_client",
+			"grant type is not allowed for the client")
+	}
+
+	var (
+		claims   *utils.Claims
+		idClaims *utils.IDTokenClaims
+	)
+	if req.GrantType == models.GrantTypeClientCredentials {
+		claims, err = s.clientCredentialsClaims(client, req)
+	} else {
+		claims, idClaims, err = s.authorizationCodeClaims(ctx, client, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token := &models.OAuthToken{
+		TokenType: "Bearer",
+		ExpiresIn: s.cfg.AccessTokenTTL * 60,
+		Scope:     claims.Scope,
+	}
+
+	if token.AccessToken, err = s.keys.Sign(claims); err != nil {
+		return nil, appError.InternalServer(err)
+	}
+
+	if idClaims != nil {
+		if token.IDToken, err = s.keys.Sign(idClaims); err != nil {
+			return nil, appError.InternalServer(err)
+		}
+	}
+
+	s.log.Info("OAuth access token issued",
+		zap.String("grant_type", req.GrantType),
+		zap.String("client_id", client.ID),
+		zap.String("sub", claims.Subject),
+	)
+
+	return token, nil
+}
+
+// authenticateClient checks the client credentials. Confidential clients must send their secret,
+// public clients must not send one.
+func (s *AuthService) authenticateClient(ctx context.Context, clientID, secret string) (*models.OAuthClient, error) {
+	if clientID == "" {
+		return nil, appError.OAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+
+	client, err := s.oauth.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, appError.ErrOAuthClientNotFound) {
+			return nil, appError.OAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		}
+		return nil, appError.InternalServer(err)
+	}
+
+	authenticated := secret == ""
+	if client.Confidential {
+		hash := utils.HashToken(secret, s.cfg.JWTRefreshSecret)
+		authenticated = secret != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash)) == 1
+	}
+
+	if !authenticated {
+		s.log.Warn("OAuth client authentication failed", zap.String("client_id", clientID))
+		return nil, appError.OAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+
+	return client, nil
+}
+
+// authorizationCodeClaims redeems the code for a token acting for the user within the granted
+// scopes only: it carries no roles or permissions of the user. The ID token claims are nil unless
+// the openid scope was granted and ID tokens can be verified by clients.
+func (s *AuthService) authorizationCodeClaims(
+	ctx context.Context,
+	client *models.OAuthClient,
+	req *models.TokenRequest,
+) (*utils.Claims, *utils.IDTokenClaims, error) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, nil, appError.OAuthError(http.StatusBadRequest, "invalid_request", "code and code_verifier are required")
+	}
+
+	// The code is used up before it is checked, a failed attempt burns it.
+	code, err := s.oauth.UseAuthorizationCode(ctx, utils.HashToken(req.Code, s.cfg.JWTRefreshSecret), time.Now())
+	if err != nil {
+		if errors.Is(err, appError.ErrInvalidToken) {
+			return nil, nil, invalidGrant("authorization code is invalid, expired or already used")
+		}
+		return nil, nil, appError.InternalServer(err)
+	}
+
+	switch {
+	case code.ClientID != client.ID:
+		return nil, nil, invalidGrant("authorization code was issued to another client")
+	case code.RedirectURI != req.RedirectURI:
+		return nil, nil, invalidGrant("redirect_uri does not match the authorization request")
+	case !utils.VerifyPKCE(req.CodeVerifier, code.CodeChallenge):
+		return nil, nil, invalidGrant("code_verifier does not match the code challenge")
+	}
+
+	user, err := s.userRepo.FindByID(ctx, code.UserID)
+	if err != nil {
+		if errors.Is(err, appError.ErrUserNotFound) {
+			return nil, nil, invalidGrant("user no longer exists")
+		}
+		return nil, nil, appError.InternalServer(err)
+	}
+
+	if checkUserActive(user) != nil {
+		return nil, nil, invalidGrant("user account is not active")
+	}
+
+	claims := utils.NewClaims(user, s.cfg.AccessTokenTTL, s.tokenOptions())
+	claims.Role = ""
+	claims.Roles = nil
+	claims.Permissions = nil
+	claims.ClientID = client.ID
+	claims.Scope = strings.Join(code.Scopes, " ")
+
+	// Codes issued before a switch to HS256 get no ID token either.
+	if !slices.Contains(code.Scopes, models.ScopeOpenID) || !s.idTokensSupported() {
+		return claims, nil, nil
+	}
+
+	return claims, s.newIDTokenClaims(user, code), nil
+}
+
+// clientCredentialsClaims issues a token whose subject is the client, limited to the requested
+// scopes, all scopes of the client by default.
+func (s *AuthService) clientCredentialsClaims(client *models.OAuthClient, req *models.TokenRequest) (*utils.Claims, error) {
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, appError.OAuthError(http.StatusBadRequest, "invalid_scope",
+				"scope "+scope+" is not allowed for the client")
+		}
+	}
+
+	return utils.NewClientClaims(client.ID, strings.Join(scopes, " "), s.cfg.AccessTokenTTL, s.tokenOptions()), nil
+}
+
+// checkAuthorizationRequest resolves the client, the redirect URI and the requested scopes. The
+// redirect URI must be registered; it may be left out when the client registered only one.
+func (s *AuthService) checkAuthorizationRequest(
+	ctx context.Context,
+	req *models.AuthorizationRequest,
+) (*models.OAuthClient, string, []string, error) {
+	if req.ClientID == "" {
+		return nil, "", nil, appError.OAuthError(http.StatusBadRequest, "invalid_request", "client_id is required")
+	}
+
+	client, err := s.oauth.GetOAuthClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, appError.ErrOAuthClientNotFound) {
+			return nil, "", nil, appError.OAuthError(http.StatusBadRequest, "invalid_request", "unknown client_id")
+		}
+		return nil, "", nil, appError.InternalServer(err)
+	}
+
+	redirectURI := req.RedirectURI
+	switch {
+	case redirectURI == "" && len(client.RedirectURIs) == 1:
+		redirectURI = client.RedirectURIs[0]
+	case !slices.Contains(client.RedirectURIs, redirectURI):
+		return nil, "", nil, appError.OAuthError(http.StatusBadRequest, "invalid_request",
+			"redirect_uri is not registered for the client")
+	}
+
+	redirectErr := func(code, description string) error {
+		apiErr := appError.OAuthError(http.StatusBadRequest, code, description)
+		apiErr.Location = redirectWithParams(redirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+		}, req.State)
+		return apiErr
+	}
+
+	if req.ResponseType != ResponseTypeCode {
+		return nil, "", nil, redirectErr("unsupported_response_type", "response_type must be code")
+	}
+
+	if !client.AllowsGrant(models.GrantTypeAuthorizationCode) {
+		return nil, "", nil, redirectErr("unauthorized_client", "client may not use the authorization code flow")
+	}
+
+	if !utils.IsPKCEValue(req.CodeChallenge) {
+		return nil, "", nil, redirectErr("invalid_request", "code_challenge is required")
+	}
+
+	if req.CodeChallengeMethod != PKCEMethodS256 {
+		return nil, "", nil, redirectErr("invalid_request", "code_challenge_method must be S256")
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, "", nil, redirectErr("invalid_scope", "scope "+scope+" is not allowed for the client")
+		}
+	}
+
+	if slices.Contains(scopes, models.ScopeOpenID) && !s.idTokensSupported() {
+		return nil, "", nil, redirectErr("invalid_scope", "openid requires an asymmetric JWT_SIGNING_ALG")
+	}
+
+	return client, redirectURI, scopes, nil
+}
+
+// redirectWithParams adds the parameters and the state of the request to the redirect URI.
+func redirectWithParams(redirectURI string, params url.Values, state string) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func invalidGrant(description string) *appError.ApiError {
+	return appError.OAuthError(http.StatusBadRequest, "invalid_grant", description)
+}
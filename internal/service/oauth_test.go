@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/internal/service/mocks"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+const (
+	testClientID     = "example-app"
+	testRedirectURI  = "https://app.example.com/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUjU2rbGBfMO8n6x1o7fs"
+)
+
+func newTestOAuthClient() *models.OAuthClient {
+	return &models.OAuthClient{
+		ID:           testClientID,
+		Name:         "Example",
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []string{models.ScopeProfile},
+		GrantTypes:   []string{models.GrantTypeAuthorizationCode},
+	}
+}
+
+func newTestAuthorizationRequest() *models.AuthorizationRequest {
+	return &models.AuthorizationRequest{
+		ResponseType:        ResponseTypeCode,
+		ClientID:            testClientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               models.ScopeProfile,
+		State:               "xyz",
+		CodeChallenge:       utils.PKCEChallenge(testCodeVerifier),
+		CodeChallengeMethod: PKCEMethodS256,
+	}
+}
+
+func TestAuthService_AuthorizeRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		modify       func(req *models.AuthorizationRequest)
+		wantCode     string
+		wantRedirect bool
+	}{
+		{
+			name:   "valid",
+			modify: func(req *models.AuthorizationRequest) {},
+		},
+		{
+			name:   "single redirect uri is the default",
+			modify: func(req *models.AuthorizationRequest) { req.RedirectURI = "" },
+		},
+		{
+			name:     "unregistered redirect uri",
+			modify:   func(req *models.AuthorizationRequest) { req.RedirectURI = "https://evil.example.com/" },
+			wantCode: "invalid_request",
+		},
+		{
+			name:         "scope not allowed",
+			modify:       func(req *models.AuthorizationRequest) { req.Scope = "profile admin" },
+			wantCode:     "invalid_scope",
+			wantRedirect: true,
+		},
+		{
+			name:         "plain pkce",
+			modify:       func(req *models.AuthorizationRequest) { req.CodeChallengeMethod = "plain" },
+			wantCode:     "invalid_request",
+			wantRedirect: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			oauth := mocks.NewMockOAuthRepository(ctrl)
+			oauth.EXPECT().GetOAuthClient(gomock.Any(), testClientID).Return(newTestOAuthClient(), nil)
+
+			s := newTestAuthService(nil, nil)
+			s.oauth = oauth
+
+			req := newTestAuthorizationRequest()
+			tt.modify(req)
+
+			consent, err := s.AuthorizeRequest(context.Background(), req)
+			if tt.wantCode == "" {
+				require.NoError(t, err)
+				assert.Equal(t, testRedirectURI, consent.RedirectURI)
+				assert.Equal(t, []string{models.ScopeProfile}, consent.Scopes)
+				return
+			}
+
+			var apiErr *appError.ApiError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.wantCode, apiErr.Code)
+
+			if !tt.wantRedirect {
+				assert.Empty(t, apiErr.Location)
+				return
+			}
+
+			location, err := url.Parse(apiErr.Location)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCode, location.Query().Get("error"))
+			assert.Equal(t, "xyz", location.Query().Get("state"))
+		})
+	}
+}
+
+func TestAuthService_ExchangeToken(t *testing.T) {
+	user := &models.User{
+		ID:          uuid.New(),
+		Email:       testEmail,
+		Roles:       []models.Role{models.RoleAdmin},
+		Permissions: []models.Permission{models.PermissionUsersWrite},
+		Status:      models.UserStatusActive,
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(req *models.TokenRequest)
+		codeErr     error
+		wantUser    bool
+		wantCode    string
+		wantStatus  int
+		wantSuccess bool
+	}{
+		{
+			name:        "success",
+			modify:      func(req *models.TokenRequest) {},
+			wantUser:    true,
+			wantSuccess: true,
+		},
+		{
+			name:       "code reused",
+			modify:     func(req *models.TokenRequest) {},
+			codeErr:    appError.ErrInvalidToken,
+			wantCode:   "invalid_grant",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "wrong verifier",
+			modify:     func(req *models.TokenRequest) { req.CodeVerifier = testCodeVerifier[1:] + "x" },
+			wantCode:   "invalid_grant",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "redirect uri mismatch",
+			modify:     func(req *models.TokenRequest) { req.RedirectURI = "https://app.example.com/other" },
+			wantCode:   "invalid_grant",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			code := &models.AuthorizationCode{
+				ClientID:      testClientID,
+				UserID:        user.ID,
+				RedirectURI:   testRedirectURI,
+				Scopes:        []string{models.ScopeProfile},
+				CodeChallenge: utils.PKCEChallenge(testCodeVerifier),
+				ExpiresAt:     time.Now().Add(time.Minute),
+			}
+			if tt.codeErr != nil {
+				code = nil
+			}
+
+			oauth := mocks.NewMockOAuthRepository(ctrl)
+			oauth.EXPECT().GetOAuthClient(gomock.Any(), testClientID).Return(newTestOAuthClient(), nil)
+			oauth.EXPECT().
+				UseAuthorizationCode(gomock.Any(), utils.HashToken("code", testRefreshSecret), gomock.Any()).
+				Return(code, tt.codeErr)
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			if tt.wantUser {
+				userRepo.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+			}
+
+			s := newTestAuthService(userRepo, nil)
+			s.oauth = oauth
+
+			req := &models.TokenRequest{
+				GrantType:    models.GrantTypeAuthorizationCode,
+				Code:         "code",
+				RedirectURI:  testRedirectURI,
+				ClientID:     testClientID,
+				CodeVerifier: testCodeVerifier,
+			}
+			tt.modify(req)
+
+			token, err := s.ExchangeToken(context.Background(), req)
+			if tt.wantSuccess {
+				require.NoError(t, err)
+				assert.Equal(t, "Bearer", token.TokenType)
+				assert.Equal(t, models.ScopeProfile, token.Scope)
+
+				claims, err := s.ParseAccessToken(token.AccessToken)
+				require.NoError(t, err)
+				assert.Equal(t, testClientID, claims.ClientID)
+				assert.True(t, claims.HasScope(models.ScopeProfile))
+				assert.Empty(t, claims.Roles)
+				assert.Empty(t, claims.Permissions)
+				return
+			}
+
+			var apiErr *appError.ApiError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.wantStatus, apiErr.StatusCode)
+			assert.Equal(t, tt.wantCode, apiErr.Code)
+		})
+	}
+}
+
+func TestAuthService_ExchangeTokenClientCredentials(t *testing.T) {
+	const secret = "batch-secret"
+
+	newClient := func() *models.OAuthClient {
+		return &models.OAuthClient{
+			ID:           "batch",
+			Scopes:       []string{"reports:read", "reports:write"},
+			GrantTypes:   []string{models.GrantTypeClientCredentials},
+			Confidential: true,
+			SecretHash:   utils.HashToken(secret, testRefreshSecret),
+		}
+	}
+
+	tests := []struct {
+		name       string
+		client     func() *models.OAuthClient
+		req        models.TokenRequest
+		wantScope  string
+		wantCode   string
+		wantStatus int
+	}{
+		{
+			name:      "all scopes by default",
+			client:    newClient,
+			req:       models.TokenRequest{ClientSecret: secret},
+			wantScope: "reports:read reports:write",
+		},
+		{
+			name:      "requested scope",
+			client:    newClient,
+			req:       models.TokenRequest{ClientSecret: secret, Scope: "reports:read"},
+			wantScope: "reports:read",
+		},
+		{
+			name:       "scope not allowed",
+			client:     newClient,
+			req:        models.TokenRequest{ClientSecret: secret, Scope: "users:write"},
+			wantCode:   "invalid_scope",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "wrong secret",
+			client:     newClient,
+			req:        models.TokenRequest{ClientSecret: "guess"},
+			wantCode:   "invalid_client",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "grant not allowed",
+			client: func() *models.OAuthClient {
+				client := newClient()
+				client.GrantTypes = []string{models.GrantTypeAuthorizationCode}
+				return client
+			},
+			req:        models.TokenRequest{ClientSecret: secret},
+			wantCode:   "unauthorized_client",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			oauth := mocks.NewMockOAuthRepository(ctrl)
+			oauth.EXPECT().GetOAuthClient(gomock.Any(), "batch").Return(tt.client(), nil)
+
+			s := newTestAuthService(nil, nil)
+			s.oauth = oauth
+
+			req := tt.req
+			req.GrantType = models.GrantTypeClientCredentials
+			req.ClientID = "batch"
+
+			token, err := s.ExchangeToken(context.Background(), &req)
+			if tt.wantStatus == 0 {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantScope, token.Scope)
+
+				claims, err := s.ParseAccessToken(token.AccessToken)
+				require.NoError(t, err)
+				assert.True(t, claims.IsClient())
+				assert.Equal(t, "batch", claims.Subject)
+				return
+			}
+
+			var apiErr *appError.ApiError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.wantStatus, apiErr.StatusCode)
+			assert.Equal(t, tt.wantCode, apiErr.Code)
+		})
+	}
+}
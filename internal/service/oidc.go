@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+// OpenIDConfiguration describes the provider for OpenID Connect discovery. The issuer is
+// APP_BASE_URL, so the document is found under the issuer as clients expect. It is the iss of ID
+// tokens only: access tokens carry JWT_ISSUER, which may differ.
+func (s *AuthService) OpenIDConfiguration() *models.OpenIDConfiguration {
+	scopes := []string{models.ScopeEmail, models.ScopeProfile}
+
+	// Only algorithms whose keys are published in the JWKS are advertised.
+	var idTokenAlgs []string
+	if s.idTokensSupported() {
+		scopes = append([]string{models.ScopeOpenID}, scopes...)
+		idTokenAlgs = []string{s.cfg.JWTSigningAlg}
+	}
+
+	grantTypes := []string{models.GrantTypeClientCredentials}
+	if s.AuthorizationEnabled() {
+		grantTypes = append([]string{models.GrantTypeAuthorizationCode}, grantTypes...)
+	}
+
+	return &models.OpenIDConfiguration{
+		Issuer:                           s.cfg.AppBaseURL,
+		AuthorizationEndpoint:            s.cfg.OAuthAuthorizationURL,
+		TokenEndpoint:                    s.cfg.AppBaseURL + "/oauth/token",
+		UserInfoEndpoint:                 s.cfg.AppBaseURL + "/userinfo",
+		JWKSURI:                          s.cfg.AppBaseURL + "/.well-known/jwks.json",
+		ScopesSupported:                  scopes,
+		ResponseTypesSupported:           []string{ResponseTypeCode},
+		GrantTypesSupported:              grantTypes,
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: idTokenAlgs,
+		TokenEndpointAuthMethodsSupported: []string{
+			"client_secret_basic",
+			"client_secret_post",
+			"none",
+		},
+		CodeChallengeMethodsSupported: []string{PKCEMethodS256},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified",
+		},
+	}
+}
+
+// UserInfo returns the claims about the user the access token was issued for. Tokens of OAuth
+// clients get the email claims only with the email scope.
+func (s *AuthService) UserInfo(ctx context.Context, claims *utils.Claims) (*models.UserInfo, error) {
+	userID, err := utils.ExtractUserID(claims)
+	if err != nil {
+		return nil, appError.Unauthorized(appError.ErrInvalidToken)
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, userError(err)
+	}
+
+	if err = checkUserActive(user); err != nil {
+		return nil, err
+	}
+
+	info := &models.UserInfo{Subject: user.ID.String()}
+	if claims.ClientID == "" || claims.HasScope(models.ScopeEmail) {
+		info.Email, info.EmailVerified = emailClaims(user)
+	}
+
+	return info, nil
+}
+
+// AuthorizationEnabled reports whether the authorization code flow is offered. It needs the consent
+// page of OAUTH_AUTHORIZATION_URL, /oauth/authorize itself is a JSON API behind Bearer auth.
+func (s *AuthService) AuthorizationEnabled() bool {
+	return s.cfg.OAuthAuthorizationURL != ""
+}
+
+// idTokensSupported reports whether clients can verify ID tokens. HMAC keys are never published in
+// the JWKS, so with HS256 an ID token could only be checked with the access token secret.
+func (s *AuthService) idTokensSupported() bool {
+	return s.cfg.JWTSigningAlg != utils.AlgHS256
+}
+
+// newIDTokenClaims builds the ID token for the client that redeemed the code, valid as long as the
+// access token issued with it.
+func (s *AuthService) newIDTokenClaims(user *models.User, code *models.AuthorizationCode) *utils.IDTokenClaims {
+	now := time.Now()
+
+	claims := &utils.IDTokenClaims{
+		Nonce:    code.Nonce,
+		AuthTime: jwt.NewNumericDate(code.AuthTime),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.AppBaseURL,
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{code.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(s.cfg.AccessTokenTTL) * time.Minute)),
+		},
+	}
+
+	if slices.Contains(code.Scopes, models.ScopeEmail) {
+		claims.Email, claims.EmailVerified = emailClaims(user)
+	}
+
+	return claims
+}
+
+// sessionAuthTime returns when the user signed in to the session. Refreshing keeps the session,
+// so this is the time of the password (and second factor) check.
+func (s *AuthService) sessionAuthTime(ctx context.Context, userID uuid.UUID, sessionID string) (time.Time, error) {
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return time.Time{}, appError.Unauthorized(appError.ErrUnknownSession)
+	}
+
+	sessions, err := s.tokenRepo.ListSessions(ctx, userID)
+	if err != nil {
+		return time.Time{}, appError.InternalServer(err)
+	}
+
+	for _, session := range sessions {
+		if session.ID == id {
+			return session.CreatedAt, nil
+		}
+	}
+
+	return time.Time{}, appError.Unauthorized(appError.ErrUnknownSession)
+}
+
+func emailClaims(user *models.User) (string, *bool) {
+	verified := user.EmailVerifiedAt != nil
+	return user.Email, &verified
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/internal/service/mocks"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+func TestAuthService_ApproveAuthorizationOpenID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := &models.User{ID: uuid.New()}
+	session := models.Session{ID: uuid.New(), CreatedAt: time.Now().Add(-time.Hour)}
+
+	client := newTestOAuthClient()
+	client.Scopes = []string{models.ScopeOpenID, models.ScopeEmail}
+
+	oauth := mocks.NewMockOAuthRepository(ctrl)
+	oauth.EXPECT().GetOAuthClient(gomock.Any(), testClientID).Return(client, nil)
+	oauth.EXPECT().
+		SaveAuthorizationCode(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, code *models.AuthorizationCode) error {
+			assert.Equal(t, "n-0S6_WzA2Mj", code.Nonce)
+			assert.Equal(t, session.CreatedAt, code.AuthTime)
+			assert.Equal(t, []string{models.ScopeOpenID, models.ScopeEmail}, code.Scopes)
+			return nil
+		})
+
+	tokenRepo := mocks.NewMockTokenRepository(ctrl)
+	tokenRepo.EXPECT().
+		ListSessions(gomock.Any(), user.ID).
+		Return([]models.Session{{ID: uuid.New()}, session}, nil)
+
+	s := newTestAuthService(nil, tokenRepo)
+	s.oauth = oauth
+	useTestIDTokenKey(t, s)
+
+	req := newTestAuthorizationRequest()
+	req.Scope = "openid email"
+	req.Nonce = "n-0S6_WzA2Mj"
+
+	redirectTo, err := s.ApproveAuthorization(context.Background(), user, session.ID.String(), req, true)
+	require.NoError(t, err)
+
+	location, err := url.Parse(redirectTo)
+	require.NoError(t, err)
+	assert.NotEmpty(t, location.Query().Get("code"))
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+}
+
+func TestAuthService_ExchangeTokenIDToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	verifiedAt := time.Now()
+	user := &models.User{ID: uuid.New(), Email: testEmail, EmailVerifiedAt: &verifiedAt}
+	authTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	oauth := mocks.NewMockOAuthRepository(ctrl)
+	oauth.EXPECT().GetOAuthClient(gomock.Any(), testClientID).Return(newTestOAuthClient(), nil)
+	oauth.EXPECT().UseAuthorizationCode(gomock.Any(), gomock.Any(), gomock.Any()).Return(&models.AuthorizationCode{
+		ClientID:      testClientID,
+		UserID:        user.ID,
+		RedirectURI:   testRedirectURI,
+		Scopes:        []string{models.ScopeOpenID, models.ScopeEmail},
+		CodeChallenge: utils.PKCEChallenge(testCodeVerifier),
+		Nonce:         "n-0S6_WzA2Mj",
+		AuthTime:      authTime,
+	}, nil)
+
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	userRepo.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+
+	s := newTestAuthService(userRepo, nil)
+	s.oauth = oauth
+	s.cfg.AppBaseURL = "https://auth.example.com"
+	key := useTestIDTokenKey(t, s)
+
+	token, err := s.ExchangeToken(context.Background(), &models.TokenRequest{
+		GrantType:    models.GrantTypeAuthorizationCode,
+		Code:         "code",
+		RedirectURI:  testRedirectURI,
+		ClientID:     testClientID,
+		CodeVerifier: testCodeVerifier,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, token.IDToken)
+
+	claims := &utils.IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(token.IDToken, claims, func(*jwt.Token) (interface{}, error) {
+		return key.PublicKey(), nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://auth.example.com", claims.Issuer)
+	assert.Equal(t, user.ID.String(), claims.Subject)
+	assert.Equal(t, jwt.ClaimStrings{testClientID}, claims.Audience)
+	assert.Equal(t, "n-0S6_WzA2Mj", claims.Nonce)
+	assert.Equal(t, authTime.Unix(), claims.AuthTime.Unix())
+	assert.Equal(t, testEmail, claims.Email)
+	require.NotNil(t, claims.EmailVerified)
+	assert.True(t, *claims.EmailVerified)
+}
+
+func TestAuthService_OpenIDWithHMAC(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := newTestOAuthClient()
+	client.Scopes = []string{models.ScopeOpenID, models.ScopeEmail}
+
+	oauth := mocks.NewMockOAuthRepository(ctrl)
+	oauth.EXPECT().GetOAuthClient(gomock.Any(), testClientID).Return(client, nil)
+
+	s := newTestAuthService(nil, nil)
+	s.oauth = oauth
+
+	config := s.OpenIDConfiguration()
+	assert.NotContains(t, config.ScopesSupported, models.ScopeOpenID)
+	assert.Empty(t, config.IDTokenSigningAlgValuesSupported)
+
+	req := newTestAuthorizationRequest()
+	req.Scope = "openid email"
+
+	_, err := s.AuthorizeRequest(context.Background(), req)
+
+	var apiErr *appError.ApiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "invalid_scope", apiErr.Code)
+
+	useTestIDTokenKey(t, s)
+
+	config = s.OpenIDConfiguration()
+	assert.Contains(t, config.ScopesSupported, models.ScopeOpenID)
+	assert.Equal(t, []string{utils.AlgES256}, config.IDTokenSigningAlgValuesSupported)
+}
+
+func TestAuthService_OpenIDConfigurationAuthorizationEndpoint(t *testing.T) {
+	s := newTestAuthService(nil, nil)
+
+	config := s.OpenIDConfiguration()
+	assert.Empty(t, config.AuthorizationEndpoint)
+	assert.Equal(t, []string{models.GrantTypeClientCredentials}, config.GrantTypesSupported)
+
+	s.cfg.OAuthAuthorizationURL = "https://app.example.com/oauth/consent"
+
+	config = s.OpenIDConfiguration()
+	assert.Equal(t, "https://app.example.com/oauth/consent", config.AuthorizationEndpoint)
+	assert.Equal(t, []string{models.GrantTypeAuthorizationCode, models.GrantTypeClientCredentials},
+		config.GrantTypesSupported)
+}
+
+func TestAuthService_UserInfo(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Email: testEmail}
+
+	tests := []struct {
+		name      string
+		claims    *utils.Claims
+		wantEmail string
+	}{
+		{
+			name:      "first-party token",
+			claims:    &utils.Claims{},
+			wantEmail: testEmail,
+		},
+		{
+			name:      "client with email scope",
+			claims:    &utils.Claims{ClientID: testClientID, Scope: "openid email"},
+			wantEmail: testEmail,
+		},
+		{
+			name:   "client without email scope",
+			claims: &utils.Claims{ClientID: testClientID, Scope: "openid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			userRepo.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+
+			s := newTestAuthService(userRepo, nil)
+
+			tt.claims.Subject = user.ID.String()
+
+			info, err := s.UserInfo(context.Background(), tt.claims)
+			require.NoError(t, err)
+			assert.Equal(t, user.ID.String(), info.Subject)
+			assert.Equal(t, tt.wantEmail, info.Email)
+
+			if tt.wantEmail == "" {
+				assert.Nil(t, info.EmailVerified)
+				return
+			}
+
+			require.NotNil(t, info.EmailVerified)
+			assert.False(t, *info.EmailVerified)
+		})
+	}
+}
+
+// useTestIDTokenKey switches the service to an ES256 key, the JWKS does not publish HMAC keys.
+func useTestIDTokenKey(t *testing.T, s *AuthService) *utils.Key {
+	key, err := utils.GenerateKey(utils.AlgES256)
+	require.NoError(t, err)
+
+	s.keys = key
+	s.cfg.JWTSigningAlg = utils.AlgES256
+
+	return key
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/mail"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+// PasswordResetEnabled reports whether reset links can be mailed. The service only takes the new
+// password by POST, so the link has to open the PASSWORD_RESET_URL page of the client app.
+func (s *AuthService) PasswordResetEnabled() bool {
+	return s.cfg.PasswordResetURL != ""
+}
+
+// ForgotPassword mails a password reset link to the user. The result is the same whether the email
+// is registered or not, so the endpoint cannot be used to enumerate accounts.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, appError.ErrUserNotFound) {
+			return nil
+		}
+		return appError.InternalServer(err)
+	}
+
+	token, err := utils.GenerateRefreshToken(32)
+	if err != nil {
+		return appError.InternalServer(err)
+	}
+
+	now := time.Now()
+	resetToken := &models.PasswordResetToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token, s.cfg.JWTRefreshSecret),
+		ExpiresAt: now.Add(time.Duration(s.cfg.PasswordResetTTL) * time.Minute),
+		CreatedAt: now,
+	}
+
+	if err = s.tokenRepo.SaveResetToken(ctx, resetToken); err != nil {
+		return appError.InternalServer(err)
+	}
+
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use the link below to choose a new password. It expires in %d minutes.\n\n%s\n\n"+
+			"If you did not ask to reset your password, ignore this email.",
+			s.cfg.PasswordResetTTL, s.passwordResetLink(token)),
+	}
+
+	// A delivery failure is logged only: answering differently would reveal that the account exists.
+	if err = s.mailer.Send(ctx, msg); err != nil {
+		s.log.Error("Failed to send password reset email", zap.Error(err), zap.String("user_id", user.ID.String()))
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token. The token is consumed, other pending reset
+// links stop working and every session of the user is ended, since whoever held the old password may
+// still be logged in. A password rejected by the policy leaves the token usable for another attempt.
+func (s *AuthService) ResetPassword(ctx context.Context, token, password string) error {
+	tokenHash := utils.HashToken(token, s.cfg.JWTRefreshSecret)
+
+	resetToken, err := s.tokenRepo.GetResetToken(ctx, tokenHash, time.Now())
+	if err != nil {
+		return s.resetTokenError(err)
+	}
+
+	user, err := s.userRepo.FindByID(ctx, resetToken.UserID)
+	if err != nil {
+		if errors.Is(err, appError.ErrUserNotFound) {
+			return appError.BadRequest(appError.ErrInvalidToken)
+		}
+		return appError.InternalServer(err)
+	}
+
+	if err = s.checkPasswordPolicy("password", password, user.Email); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// Consuming the token is what makes it single use, the lookup above only validated it. Like
+	// revokeSessions, but in one transaction with the new password, so a failure cannot use up the
+	// token and leave the old password or its sessions in place.
+	if err = s.userRepo.ResetPassword(ctx, tokenHash, hashedPassword, time.Now()); err != nil {
+		return s.resetTokenError(err)
+	}
+
+	s.log.Info("Password reset", zap.String("user_id", user.ID.String()))
+
+	return nil
+}
+
+// ChangePassword replaces the password of a logged in user who knows the current one. Every other
+// session and every pending reset link is ended; like LogoutOthers this invalidates the caller's
+// access token too, so a fresh one for the current session is returned. Wrong current passwords
+// count towards the account lockout.
+func (s *AuthService) ChangePassword(
+	ctx context.Context,
+	user *models.User,
+	sessionID, currentPassword, newPassword string,
+) (string, error) {
+	currentID, err := uuid.Parse(sessionID)
+	if err != nil {
+		return "", appError.BadRequest(appError.ErrUnknownSession)
+	}
+
+	attempt, err := s.checkLoginAllowed(ctx, user.Email, "")
+	if err != nil {
+		return "", err
+	}
+
+	ok, err := s.hasher.Verify(currentPassword, user.Password)
+	if err != nil {
+		s.log.Error("Failed to verify password hash", zap.Error(err), zap.String("user_id", user.ID.String()))
+		return "", appError.InternalServer(appError.ErrInternalServer)
+	}
+
+	if !ok {
+		return "", s.loginFailed(attempt, user.Email, "",
+			appError.ValidationFailed(map[string][]string{"current_password": {"is incorrect"}}))
+	}
+
+	if err = s.loginSucceeded(ctx, user.Email, ""); err != nil {
+		return "", err
+	}
+
+	if currentPassword == newPassword {
+		return "", appError.ValidationFailed(map[string][]string{"new_password": {"must differ from the current password"}})
+	}
+
+	if err = s.checkPasswordPolicy("new_password", newPassword, user.Email); err != nil {
+		return "", err
+	}
+
+	hashedPassword, err := s.hashPassword(newPassword)
+	if err != nil {
+		return "", err
+	}
+
+	// Like revokeSessions, but in one transaction with the new password, so a failure cannot leave
+	// sessions of the old password alive. Reset links mailed before the change stop working too.
+	version, err := s.userRepo.ChangePassword(ctx, user.ID, hashedPassword, currentID, time.Now())
+	if err != nil {
+		return "", appError.InternalServer(err)
+	}
+
+	accessToken, err := s.reissueAccessToken(user, currentID, version)
+	if err != nil {
+		return "", err
+	}
+
+	s.log.Info("Password changed", zap.String("user_id", user.ID.String()))
+
+	return accessToken, nil
+}
+
+func (s *AuthService) resetTokenError(err error) error {
+	if errors.Is(err, appError.ErrInvalidToken) {
+		return appError.BadRequest(appError.ErrInvalidToken)
+	}
+	return appError.InternalServer(err)
+}
+
+// passwordResetLink adds the token to PasswordResetURL, keeping the query the page may already have.
+func (s *AuthService) passwordResetLink(token string) string {
+	link, err := url.Parse(s.cfg.PasswordResetURL)
+	if err != nil {
+		return s.cfg.PasswordResetURL + "?token=" + url.QueryEscape(token)
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return link.String()
+}
@@ -0,0 +1,346 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/mail"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/internal/service/mocks"
+)
+
+func TestAuthService_ForgotPassword(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Email: testEmail}
+
+	tests := []struct {
+		name          string
+		mockUserRepo  func(m *mocks.MockUserRepository)
+		mockTokenRepo func(m *mocks.MockTokenRepository)
+		wantMail      bool
+		wantErr       bool
+	}{
+		{
+			name: "registered email",
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByEmail(gomock.Any(), testEmail).Return(user, nil)
+			},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {
+				m.EXPECT().
+					SaveResetToken(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, token *models.PasswordResetToken) error {
+						assert.Equal(t, user.ID, token.UserID)
+						assert.NotEmpty(t, token.TokenHash)
+						assert.WithinDuration(t, time.Now().Add(30*time.Minute), token.ExpiresAt, time.Second)
+						return nil
+					})
+			},
+			wantMail: true,
+		},
+		{
+			name: "unknown email",
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByEmail(gomock.Any(), testEmail).Return(nil, appError.ErrUserNotFound)
+			},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {
+				m.EXPECT().SaveResetToken(gomock.Any(), gomock.Any()).Times(0)
+			},
+		},
+		{
+			name: "storage failure",
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByEmail(gomock.Any(), testEmail).Return(user, nil)
+			},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {
+				m.EXPECT().SaveResetToken(gomock.Any(), gomock.Any()).Return(assert.AnError)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			tokenRepo := mocks.NewMockTokenRepository(ctrl)
+			tt.mockUserRepo(userRepo)
+			tt.mockTokenRepo(tokenRepo)
+
+			var outbox bytes.Buffer
+			s := newTestAuthService(userRepo, tokenRepo)
+			s.mailer = mail.NewWriterSender(&outbox)
+			s.cfg.PasswordResetURL = "https://app.example.com/reset-password"
+			s.cfg.PasswordResetTTL = 30
+
+			err := s.ForgotPassword(context.Background(), testEmail)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			if tt.wantMail {
+				assert.Contains(t, outbox.String(), "To: "+testEmail)
+				assert.Contains(t, outbox.String(), "https://app.example.com/reset-password?token=")
+			} else {
+				assert.Empty(t, outbox.String())
+			}
+		})
+	}
+}
+
+func TestAuthService_PasswordResetLink(t *testing.T) {
+	tests := []struct {
+		name     string
+		resetURL string
+		want     string
+	}{
+		{
+			name:     "page without query",
+			resetURL: "https://app.example.com/reset-password",
+			want:     "https://app.example.com/reset-password?token=a%2Bb%2Fc",
+		},
+		{
+			name:     "page with query",
+			resetURL: "https://app.example.com/account?lang=en#reset",
+			want:     "https://app.example.com/account?lang=en&token=a%2Bb%2Fc#reset",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestAuthService(nil, nil)
+			s.cfg.PasswordResetURL = tt.resetURL
+
+			assert.Equal(t, tt.want, s.passwordResetLink("a+b/c"))
+		})
+	}
+}
+
+func TestAuthService_ResetPassword(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Email: testEmail}
+	resetToken := &models.PasswordResetToken{ID: uuid.New(), UserID: user.ID}
+	const newPassword = "new-password123"
+
+	tests := []struct {
+		name          string
+		password      string
+		mockUserRepo  func(m *mocks.MockUserRepository)
+		mockTokenRepo func(m *mocks.MockTokenRepository)
+		wantStatus    int
+		wantFields    map[string][]string
+	}{
+		{
+			name:     "valid token",
+			password: newPassword,
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+				m.EXPECT().
+					ResetPassword(gomock.Any(), testRefreshHash, gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, tokenHash, hash string, resetAt time.Time) error {
+						assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte(newPassword)))
+						return nil
+					})
+			},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {
+				m.EXPECT().GetResetToken(gomock.Any(), testRefreshHash, gomock.Any()).Return(resetToken, nil)
+			},
+		},
+		{
+			name:     "password rejected by policy keeps the token",
+			password: "test-1",
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+				m.EXPECT().ResetPassword(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {
+				m.EXPECT().GetResetToken(gomock.Any(), testRefreshHash, gomock.Any()).Return(resetToken, nil)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantFields: map[string][]string{"password": {
+				"must be at least 8 characters long",
+				"must not contain the email address",
+			}},
+		},
+		{
+			name:         "used, expired or unknown token",
+			password:     newPassword,
+			mockUserRepo: func(m *mocks.MockUserRepository) {},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {
+				m.EXPECT().
+					GetResetToken(gomock.Any(), testRefreshHash, gomock.Any()).
+					Return(nil, appError.ErrInvalidToken)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:     "token used concurrently",
+			password: newPassword,
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+				m.EXPECT().
+					ResetPassword(gomock.Any(), testRefreshHash, gomock.Any(), gomock.Any()).
+					Return(appError.ErrInvalidToken)
+			},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {
+				m.EXPECT().GetResetToken(gomock.Any(), testRefreshHash, gomock.Any()).Return(resetToken, nil)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "storage failure",
+			password:     newPassword,
+			mockUserRepo: func(m *mocks.MockUserRepository) {},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {
+				m.EXPECT().
+					GetResetToken(gomock.Any(), testRefreshHash, gomock.Any()).
+					Return(nil, assert.AnError)
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			tokenRepo := mocks.NewMockTokenRepository(ctrl)
+			tt.mockUserRepo(userRepo)
+			tt.mockTokenRepo(tokenRepo)
+
+			s := newTestAuthService(userRepo, tokenRepo)
+
+			err := s.ResetPassword(context.Background(), testRefreshToken, tt.password)
+			if tt.wantStatus == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var apiErr *appError.ApiError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.wantStatus, apiErr.StatusCode)
+			assert.Equal(t, tt.wantFields, apiErr.Fields)
+		})
+	}
+}
+
+func TestAuthService_ChangePassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := &models.User{ID: uuid.New(), Email: testEmail, Password: string(hash), Roles: []models.Role{models.RoleUser}}
+	sessionID := uuid.New()
+	const newPassword = "new-password123"
+
+	tests := []struct {
+		name            string
+		currentPassword string
+		newPassword     string
+		mockUserRepo    func(m *mocks.MockUserRepository)
+		mockTokenRepo   func(m *mocks.MockTokenRepository)
+		wantFields      map[string][]string
+	}{
+		{
+			name:            "success",
+			currentPassword: testPassword,
+			newPassword:     newPassword,
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().
+					ChangePassword(gomock.Any(), user.ID, gomock.Any(), sessionID, gomock.Any()).
+					DoAndReturn(func(ctx context.Context, id uuid.UUID, hash string, keep uuid.UUID, changedAt time.Time) (int64, error) {
+						assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte(newPassword)))
+						assert.WithinDuration(t, time.Now(), changedAt, time.Second)
+						return 2, nil
+					})
+			},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {},
+		},
+		{
+			name:            "wrong current password",
+			currentPassword: "wrong-password",
+			newPassword:     newPassword,
+			mockUserRepo:    func(m *mocks.MockUserRepository) {},
+			mockTokenRepo:   func(m *mocks.MockTokenRepository) {},
+			wantFields:      map[string][]string{"current_password": {"is incorrect"}},
+		},
+		{
+			name:            "same password",
+			currentPassword: testPassword,
+			newPassword:     testPassword,
+			mockUserRepo:    func(m *mocks.MockUserRepository) {},
+			mockTokenRepo:   func(m *mocks.MockTokenRepository) {},
+			wantFields:      map[string][]string{"new_password": {"must differ from the current password"}},
+		},
+		{
+			name:            "new password rejected by policy",
+			currentPassword: testPassword,
+			newPassword:     "short",
+			mockUserRepo:    func(m *mocks.MockUserRepository) {},
+			mockTokenRepo:   func(m *mocks.MockTokenRepository) {},
+			wantFields:      map[string][]string{"new_password": {"must be at least 8 characters long"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			tokenRepo := mocks.NewMockTokenRepository(ctrl)
+			tt.mockUserRepo(userRepo)
+			tt.mockTokenRepo(tokenRepo)
+
+			s := newTestAuthService(userRepo, tokenRepo)
+			s.attempts = newUnlimitedAttempts(ctrl)
+
+			accessToken, err := s.ChangePassword(context.Background(), user, sessionID.String(), tt.currentPassword, tt.newPassword)
+			if tt.wantFields != nil {
+				var apiErr *appError.ApiError
+				require.ErrorAs(t, err, &apiErr)
+				assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+				assert.Equal(t, tt.wantFields, apiErr.Fields)
+				return
+			}
+
+			require.NoError(t, err)
+
+			claims, err := s.ParseAccessToken(accessToken)
+			require.NoError(t, err)
+			assert.Equal(t, sessionID.String(), claims.SessionID)
+			assert.Equal(t, int64(2), claims.TokenVersion)
+		})
+	}
+}
+
+func TestAuthService_ChangePasswordLocked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	attempts := mocks.NewMockLoginAttemptStore(ctrl)
+	s := newTestAuthService(nil, nil)
+	s.attempts = attempts
+
+	attempts.EXPECT().
+		GetLoginAttempt(gomock.Any(), "account:"+testEmail).
+		Return(&models.LoginAttempt{Failures: 5, LastFailureAt: time.Now()}, nil)
+
+	_, err := s.ChangePassword(context.Background(), &models.User{Email: testEmail}, uuid.NewString(), testPassword, "new-password123")
+
+	var apiErr *appError.ApiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusLocked, apiErr.StatusCode)
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+)
+
+func (s *AuthService) ListRoles(ctx context.Context) ([]models.RoleDefinition, error) {
+	roles, err := s.roles.ListRoles(ctx)
+	if err != nil {
+		return nil, appError.InternalServer(err)
+	}
+
+	return roles, nil
+}
+
+func (s *AuthService) ListPermissions(ctx context.Context) ([]models.PermissionDefinition, error) {
+	permissions, err := s.roles.ListPermissions(ctx)
+	if err != nil {
+		return nil, appError.InternalServer(err)
+	}
+
+	return permissions, nil
+}
+
+// CreateRole adds a role granting the given permissions, which must already exist.
+func (s *AuthService) CreateRole(
+	ctx context.Context,
+	name models.Role,
+	description string,
+	permissions []models.Permission,
+) (*models.RoleDefinition, error) {
+	role := &models.RoleDefinition{
+		Name:        name,
+		Description: description,
+		Permissions: permissions,
+		CreatedAt:   time.Now(),
+	}
+
+	if err := s.roles.CreateRole(ctx, role); err != nil {
+		return nil, roleError(err)
+	}
+
+	s.log.Info("Role created", zap.String("role", string(name)))
+
+	return role, nil
+}
+
+// SetRolePermissions replaces the permissions of the role. Access tokens carry a snapshot of the
+// permissions, so the tokens of every holder of the role are invalidated; their sessions stay and
+// get tokens with the new permissions on refresh.
+func (s *AuthService) SetRolePermissions(ctx context.Context, name models.Role, permissions []models.Permission) error {
+	if err := s.roles.SetRolePermissions(ctx, name, permissions); err != nil {
+		return roleError(err)
+	}
+
+	s.log.Info("Role permissions changed", zap.String("role", string(name)))
+
+	return nil
+}
+
+// DeleteRole removes a role from every user holding it and invalidates their access tokens, like
+// RevokeRole does. RoleAdmin and RoleUser are kept.
+func (s *AuthService) DeleteRole(ctx context.Context, name models.Role) error {
+	if name == models.RoleAdmin || name == models.RoleUser {
+		return appError.Conflict(appError.ErrBuiltinRole)
+	}
+
+	if err := s.roles.DeleteRole(ctx, name); err != nil {
+		return roleError(err)
+	}
+
+	s.log.Info("Role deleted", zap.String("role", string(name)))
+
+	return nil
+}
+
+// AssignRole gives the user a role, the granted permissions apply from the next token the user gets.
+func (s *AuthService) AssignRole(ctx context.Context, userID uuid.UUID, role models.Role) error {
+	if err := s.findUser(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.roles.AssignRole(ctx, userID, role, time.Now()); err != nil {
+		return roleError(err)
+	}
+
+	s.log.Info("Role assigned", zap.String("user_id", userID.String()), zap.String("role", string(role)))
+
+	return nil
+}
+
+// RevokeRole takes a role away from the user. The access tokens of the user still carry its
+// permissions, so they are invalidated; sessions stay and get tokens without the role on refresh.
+func (s *AuthService) RevokeRole(ctx context.Context, userID uuid.UUID, role models.Role) error {
+	if err := s.findUser(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.roles.UnassignRole(ctx, userID, role); err != nil {
+		if errors.Is(err, appError.ErrRoleNotAssigned) {
+			return appError.NotFound(err)
+		}
+		return appError.InternalServer(err)
+	}
+
+	if _, err := s.userRepo.BumpTokenVersion(ctx, userID); err != nil {
+		return appError.InternalServer(err)
+	}
+
+	s.log.Info("Role revoked", zap.String("user_id", userID.String()), zap.String("role", string(role)))
+
+	return nil
+}
+
+// roleError classifies errors of the role repository.
+func roleError(err error) error {
+	switch {
+	case errors.Is(err, appError.ErrRoleNotFound):
+		return appError.NotFound(err)
+	case errors.Is(err, appError.ErrRoleAlreadyExists):
+		return appError.Conflict(err)
+	case errors.Is(err, appError.ErrUnknownPermission):
+		return appError.BadRequest(err)
+	default:
+		return appError.InternalServer(err)
+	}
+}
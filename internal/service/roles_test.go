@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/internal/service/mocks"
+)
+
+const testRole models.Role = "support"
+
+func TestAuthService_CreateRole(t *testing.T) {
+	tests := []struct {
+		name       string
+		repoErr    error
+		wantStatus int
+	}{
+		{name: "success"},
+		{name: "name taken", repoErr: appError.ErrRoleAlreadyExists, wantStatus: http.StatusConflict},
+		{name: "unknown permission", repoErr: appError.ErrUnknownPermission, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			roles := mocks.NewMockRoleRepository(ctrl)
+			s := newTestAuthService(nil, nil)
+			s.roles = roles
+
+			permissions := []models.Permission{models.PermissionUsersRead}
+			roles.EXPECT().
+				CreateRole(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, role *models.RoleDefinition) error {
+					assert.Equal(t, testRole, role.Name)
+					assert.Equal(t, permissions, role.Permissions)
+					return tt.repoErr
+				})
+
+			role, err := s.CreateRole(context.Background(), testRole, "Support staff", permissions)
+			if tt.wantStatus == 0 {
+				require.NoError(t, err)
+				assert.WithinDuration(t, time.Now(), role.CreatedAt, time.Second)
+				return
+			}
+
+			var apiErr *appError.ApiError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.wantStatus, apiErr.StatusCode)
+		})
+	}
+}
+
+func TestAuthService_SetRolePermissions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	permissions := []models.Permission{models.PermissionUsersRead}
+
+	roles := mocks.NewMockRoleRepository(ctrl)
+	roles.EXPECT().SetRolePermissions(gomock.Any(), testRole, permissions).Return(nil)
+	roles.EXPECT().SetRolePermissions(gomock.Any(), testRole, permissions).Return(appError.ErrUnknownPermission)
+
+	s := newTestAuthService(nil, nil)
+	s.roles = roles
+
+	assert.NoError(t, s.SetRolePermissions(context.Background(), testRole, permissions))
+
+	err := s.SetRolePermissions(context.Background(), testRole, permissions)
+	var apiErr *appError.ApiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+}
+
+func TestAuthService_DeleteRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	roles := mocks.NewMockRoleRepository(ctrl)
+	s := newTestAuthService(nil, nil)
+	s.roles = roles
+
+	var apiErr *appError.ApiError
+
+	err := s.DeleteRole(context.Background(), models.RoleAdmin)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusConflict, apiErr.StatusCode)
+
+	roles.EXPECT().DeleteRole(gomock.Any(), testRole).Return(appError.ErrRoleNotFound)
+
+	err = s.DeleteRole(context.Background(), testRole)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+
+	roles.EXPECT().DeleteRole(gomock.Any(), testRole).Return(nil)
+
+	assert.NoError(t, s.DeleteRole(context.Background(), testRole))
+}
+
+func TestAuthService_RevokeRole(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name         string
+		mockUserRepo func(m *mocks.MockUserRepository)
+		mockRoles    func(m *mocks.MockRoleRepository)
+		wantStatus   int
+	}{
+		{
+			name: "success invalidates access tokens",
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByID(gomock.Any(), userID).Return(&models.User{ID: userID}, nil)
+				m.EXPECT().BumpTokenVersion(gomock.Any(), userID).Return(int64(1), nil)
+			},
+			mockRoles: func(m *mocks.MockRoleRepository) {
+				m.EXPECT().UnassignRole(gomock.Any(), userID, testRole).Return(nil)
+			},
+		},
+		{
+			name: "role not assigned",
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByID(gomock.Any(), userID).Return(&models.User{ID: userID}, nil)
+			},
+			mockRoles: func(m *mocks.MockRoleRepository) {
+				m.EXPECT().UnassignRole(gomock.Any(), userID, testRole).Return(appError.ErrRoleNotAssigned)
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "unknown user",
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByID(gomock.Any(), userID).Return(nil, appError.ErrUserNotFound)
+			},
+			mockRoles:  func(m *mocks.MockRoleRepository) {},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			roles := mocks.NewMockRoleRepository(ctrl)
+			tt.mockUserRepo(userRepo)
+			tt.mockRoles(roles)
+
+			s := newTestAuthService(userRepo, nil)
+			s.roles = roles
+
+			err := s.RevokeRole(context.Background(), userID, testRole)
+			if tt.wantStatus == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var apiErr *appError.ApiError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.wantStatus, apiErr.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+)
+
+const (
+	DefaultUserPageSize = 20
+	MaxUserPageSize     = 100
+)
+
+// ListUsers returns a page of users whose email contains filter.Email. The page size defaults to
+// DefaultUserPageSize and is capped at MaxUserPageSize.
+func (s *AuthService) ListUsers(ctx context.Context, filter models.UserFilter) (*models.UserPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultUserPageSize
+	}
+	if filter.Limit > MaxUserPageSize {
+		filter.Limit = MaxUserPageSize
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	users, total, err := s.userRepo.ListUsers(ctx, filter)
+	if err != nil {
+		return nil, appError.InternalServer(err)
+	}
+
+	return &models.UserPage{
+		Users:  users,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}, nil
+}
+
+func (s *AuthService) GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, appError.ErrUserNotFound) {
+			return nil, appError.NotFound(err)
+		}
+		return nil, appError.InternalServer(err)
+	}
+
+	return user, nil
+}
+
+// SetUserRoles replaces the roles of the user. Access tokens of the user may carry permissions of
+// a removed role, so they are invalidated; sessions stay and get tokens with the new roles on refresh.
+func (s *AuthService) SetUserRoles(ctx context.Context, userID uuid.UUID, roles []models.Role) error {
+	if err := s.findUser(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.roles.SetUserRoles(ctx, userID, roles, time.Now()); err != nil {
+		if errors.Is(err, appError.ErrRoleNotFound) {
+			return appError.BadRequest(err)
+		}
+		return appError.InternalServer(err)
+	}
+
+	if _, err := s.userRepo.BumpTokenVersion(ctx, userID); err != nil {
+		return appError.InternalServer(err)
+	}
+
+	s.log.Info("User roles changed", zap.String("user_id", userID.String()))
+
+	return nil
+}
+
+// SuspendUser blocks the account and ends all its sessions; the user is refused with a clear code
+// until ActivateUser. actorID is the admin doing it, who cannot suspend their own account.
+func (s *AuthService) SuspendUser(ctx context.Context, actorID, userID uuid.UUID, reason string) error {
+	if actorID == userID {
+		return appError.Forbidden(appError.ErrOwnAccount)
+	}
+
+	if err := s.userRepo.SetStatus(ctx, userID, models.UserStatusSuspended, reason, time.Now()); err != nil {
+		return userError(err)
+	}
+
+	if _, err := s.revokeSessions(ctx, userID, uuid.Nil); err != nil {
+		return err
+	}
+
+	s.log.Info("User suspended", zap.String("user_id", userID.String()), zap.String("reason", reason))
+
+	return nil
+}
+
+// ActivateUser lets a suspended, pending or deleted account log in again.
+func (s *AuthService) ActivateUser(ctx context.Context, userID uuid.UUID) error {
+	if err := s.userRepo.SetStatus(ctx, userID, models.UserStatusActive, "", time.Now()); err != nil {
+		return userError(err)
+	}
+
+	s.log.Info("User activated", zap.String("user_id", userID.String()))
+
+	return nil
+}
+
+// ForceLogout ends every session of the user, like LogoutAll done by the user.
+func (s *AuthService) ForceLogout(ctx context.Context, userID uuid.UUID) error {
+	if err := s.findUser(ctx, userID); err != nil {
+		return err
+	}
+
+	if _, err := s.revokeSessions(ctx, userID, uuid.Nil); err != nil {
+		return err
+	}
+
+	s.log.Info("User logged out by admin", zap.String("user_id", userID.String()))
+
+	return nil
+}
+
+// DeleteUser marks the account deleted and ends all its sessions. The row is kept, so the email
+// stays taken and the account can be restored with ActivateUser. actorID cannot be userID.
+func (s *AuthService) DeleteUser(ctx context.Context, actorID, userID uuid.UUID) error {
+	if actorID == userID {
+		return appError.Forbidden(appError.ErrOwnAccount)
+	}
+
+	if err := s.userRepo.SetStatus(ctx, userID, models.UserStatusDeleted, "", time.Now()); err != nil {
+		return userError(err)
+	}
+
+	if _, err := s.revokeSessions(ctx, userID, uuid.Nil); err != nil {
+		return err
+	}
+
+	s.log.Info("User deleted", zap.String("user_id", userID.String()))
+
+	return nil
+}
+
+// checkUserActive refuses accounts that are not active, with a code telling clients why.
+func checkUserActive(user *models.User) error {
+	switch user.Status {
+	case models.UserStatusSuspended:
+		return appError.Forbidden(appError.ErrAccountSuspended).WithCode("account_suspended")
+	case models.UserStatusPending:
+		return appError.Forbidden(appError.ErrAccountPending).WithCode("account_pending")
+	case models.UserStatusDeleted:
+		return appError.Forbidden(appError.ErrAccountDeleted).WithCode("account_deleted")
+	default:
+		return nil
+	}
+}
+
+func (s *AuthService) findUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.GetUser(ctx, userID)
+	return err
+}
+
+func userError(err error) error {
+	if errors.Is(err, appError.ErrUserNotFound) {
+		return appError.NotFound(err)
+	}
+	return appError.InternalServer(err)
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/internal/service/mocks"
+)
+
+func TestAuthService_ListUsers(t *testing.T) {
+	tests := []struct {
+		name       string
+		filter     models.UserFilter
+		wantFilter models.UserFilter
+	}{
+		{
+			name:       "default page size",
+			filter:     models.UserFilter{Email: "example"},
+			wantFilter: models.UserFilter{Email: "example", Limit: DefaultUserPageSize},
+		},
+		{
+			name:       "page size capped",
+			filter:     models.UserFilter{Limit: 1000, Offset: 40},
+			wantFilter: models.UserFilter{Limit: MaxUserPageSize, Offset: 40},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			userRepo.EXPECT().
+				ListUsers(gomock.Any(), tt.wantFilter).
+				Return([]models.User{{ID: uuid.New(), Email: testEmail}}, 41, nil)
+
+			s := newTestAuthService(userRepo, nil)
+
+			page, err := s.ListUsers(context.Background(), tt.filter)
+			require.NoError(t, err)
+			assert.Len(t, page.Users, 1)
+			assert.Equal(t, 41, page.Total)
+			assert.Equal(t, tt.wantFilter.Limit, page.Limit)
+			assert.Equal(t, tt.wantFilter.Offset, page.Offset)
+		})
+	}
+}
+
+func TestAuthService_SuspendUser(t *testing.T) {
+	adminID := uuid.New()
+	userID := uuid.New()
+
+	tests := []struct {
+		name          string
+		actorID       uuid.UUID
+		mockUserRepo  func(m *mocks.MockUserRepository)
+		mockTokenRepo func(m *mocks.MockTokenRepository)
+		wantStatus    int
+	}{
+		{
+			name:    "success ends sessions",
+			actorID: adminID,
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().
+					SetStatus(gomock.Any(), userID, models.UserStatusSuspended, "compromised", gomock.Any()).
+					Return(nil)
+				m.EXPECT().BumpTokenVersion(gomock.Any(), userID).Return(int64(1), nil)
+			},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {
+				m.EXPECT().DeleteUserTokens(gomock.Any(), userID, uuid.Nil).Return(nil)
+			},
+		},
+		{
+			name:    "unknown user",
+			actorID: adminID,
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().
+					SetStatus(gomock.Any(), userID, gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(appError.ErrUserNotFound)
+			},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {},
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:          "own account",
+			actorID:       userID,
+			mockUserRepo:  func(m *mocks.MockUserRepository) {},
+			mockTokenRepo: func(m *mocks.MockTokenRepository) {},
+			wantStatus:    http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			tokenRepo := mocks.NewMockTokenRepository(ctrl)
+			tt.mockUserRepo(userRepo)
+			tt.mockTokenRepo(tokenRepo)
+
+			s := newTestAuthService(userRepo, tokenRepo)
+
+			err := s.SuspendUser(context.Background(), tt.actorID, userID, "compromised")
+			if tt.wantStatus == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var apiErr *appError.ApiError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.wantStatus, apiErr.StatusCode)
+		})
+	}
+}
+
+func TestAuthService_LoginUserStatus(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	tests := []struct {
+		status   models.UserStatus
+		wantCode string
+	}{
+		{status: models.UserStatusSuspended, wantCode: "account_suspended"},
+		{status: models.UserStatusPending, wantCode: "account_pending"},
+		{status: models.UserStatusDeleted, wantCode: "account_deleted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			user := &models.User{ID: uuid.New(), Email: testEmail, Password: string(hash), Status: tt.status}
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			userRepo.EXPECT().FindByEmail(gomock.Any(), testEmail).Return(user, nil)
+
+			s := newTestAuthService(userRepo, nil)
+			s.attempts = newUnlimitedAttempts(ctrl)
+
+			_, _, err := s.Login(context.Background(), testEmail, testPassword, &models.Session{})
+
+			var apiErr *appError.ApiError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+			assert.Equal(t, tt.wantCode, apiErr.Code)
+		})
+	}
+}
+
+func TestAuthService_ExtractUserFromTokenSuspended(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := &models.User{ID: uuid.New(), Status: models.UserStatusSuspended}
+
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	userRepo.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+
+	revocations := mocks.NewMockRevocationStore(ctrl)
+	revocations.EXPECT().IsAccessTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+
+	s := newTestAuthService(userRepo, nil)
+	s.revocations = revocations
+
+	token, err := s.GenerateAccessToken(user, uuid.New())
+	require.NoError(t, err)
+
+	_, _, err = s.ExtractUserFromToken(context.Background(), token)
+
+	var apiErr *appError.ApiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "account_suspended", apiErr.Code)
+}
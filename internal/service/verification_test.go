@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/mail"
+	"github.com/sanchey92/jwt-example/internal/models"
+	"github.com/sanchey92/jwt-example/internal/service/mocks"
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+var verificationLink = regexp.MustCompile(`/verify-email\?token=(\S+)`)
+
+func TestAuthService_RegisterSendsVerificationEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userRepo := mocks.NewMockUserRepository(ctrl)
+	userRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil)
+
+	var outbox bytes.Buffer
+	s := newTestAuthService(userRepo, nil)
+	s.mailer = mail.NewWriterSender(&outbox)
+	s.cfg.EmailVerificationTTL = 24
+
+	user, err := s.Register(context.Background(), testEmail, testPassword)
+	require.NoError(t, err)
+	assert.Nil(t, user.EmailVerifiedAt)
+
+	match := verificationLink.FindStringSubmatch(outbox.String())
+	require.Len(t, match, 2)
+
+	token, err := url.QueryUnescape(match[1])
+	require.NoError(t, err)
+
+	userRepo.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+	userRepo.EXPECT().SetEmailVerified(gomock.Any(), user.ID, gomock.Any()).Return(nil)
+
+	assert.NoError(t, s.VerifyEmail(context.Background(), token))
+}
+
+func TestAuthService_VerifyEmail(t *testing.T) {
+	verifiedAt := time.Now()
+	user := &models.User{ID: uuid.New(), Email: testEmail}
+
+	sign := func(subject string, ttl time.Duration) string {
+		return utils.SignToken(subject, time.Now().Add(ttl), testRefreshSecret)
+	}
+	validSubject := emailVerificationPurpose + "|" + user.ID.String() + "|" + testEmail
+
+	tests := []struct {
+		name         string
+		token        string
+		mockUserRepo func(m *mocks.MockUserRepository)
+		wantStatus   int
+	}{
+		{
+			name:  "valid link",
+			token: sign(validSubject, time.Hour),
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+				m.EXPECT().SetEmailVerified(gomock.Any(), user.ID, gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name:  "already verified",
+			token: sign(validSubject, time.Hour),
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				verified := *user
+				verified.EmailVerifiedAt = &verifiedAt
+				m.EXPECT().FindByID(gomock.Any(), user.ID).Return(&verified, nil)
+			},
+		},
+		{
+			name:         "expired link",
+			token:        sign(validSubject, -time.Minute),
+			mockUserRepo: func(m *mocks.MockUserRepository) {},
+			wantStatus:   http.StatusBadRequest,
+		},
+		{
+			name:         "other purpose",
+			token:        sign("password-reset|"+user.ID.String()+"|"+testEmail, time.Hour),
+			mockUserRepo: func(m *mocks.MockUserRepository) {},
+			wantStatus:   http.StatusBadRequest,
+		},
+		{
+			name:  "email changed",
+			token: sign(emailVerificationPurpose+"|"+user.ID.String()+"|old@example.com", time.Hour),
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByID(gomock.Any(), user.ID).Return(user, nil)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "deleted user",
+			token: sign(validSubject, time.Hour),
+			mockUserRepo: func(m *mocks.MockUserRepository) {
+				m.EXPECT().FindByID(gomock.Any(), user.ID).Return(nil, appError.ErrUserNotFound)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			userRepo := mocks.NewMockUserRepository(ctrl)
+			tt.mockUserRepo(userRepo)
+
+			s := newTestAuthService(userRepo, nil)
+
+			err := s.VerifyEmail(context.Background(), tt.token)
+			if tt.wantStatus == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var apiErr *appError.ApiError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.wantStatus, apiErr.StatusCode)
+		})
+	}
+}
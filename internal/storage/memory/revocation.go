@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RevocationStore keeps revoked access token IDs in process memory. Entries are dropped once the
+// token has expired, so the map never outgrows the number of tokens revoked within one access TTL.
+// It is not shared between instances; use the Postgres store when running more than one.
+type RevocationStore struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+func NewRevocationStore() *RevocationStore {
+	return &RevocationStore{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+func (s *RevocationStore) RevokeAccessToken(_ context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range s.revoked {
+		if !now.Before(exp) {
+			delete(s.revoked, id)
+		}
+	}
+
+	if now.Before(expiresAt) {
+		s.revoked[jti] = expiresAt
+	}
+
+	return nil
+}
+
+func (s *RevocationStore) IsAccessTokenRevoked(_ context.Context, jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	exp, ok := s.revoked[jti]
+	return ok && time.Now().Before(exp), nil
+}
+
+// Len returns the number of tracked entries, including expired ones not purged yet.
+func (s *RevocationStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.revoked)
+}
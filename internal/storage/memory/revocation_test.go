@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevocationStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewRevocationStore()
+
+	assert.NoError(t, s.RevokeAccessToken(ctx, "active", time.Now().Add(time.Minute)))
+	assert.NoError(t, s.RevokeAccessToken(ctx, "expired", time.Now().Add(-time.Minute)))
+
+	revoked, err := s.IsAccessTokenRevoked(ctx, "active")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = s.IsAccessTokenRevoked(ctx, "expired")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	revoked, err = s.IsAccessTokenRevoked(ctx, "unknown")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestRevocationStore_PurgesExpired(t *testing.T) {
+	ctx := context.Background()
+	s := NewRevocationStore()
+
+	assert.NoError(t, s.RevokeAccessToken(ctx, "short", time.Now().Add(10*time.Millisecond)))
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, s.RevokeAccessToken(ctx, "long", time.Now().Add(time.Minute)))
+
+	assert.Equal(t, 1, s.Len())
+}
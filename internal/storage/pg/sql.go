@@ -1,26 +1,272 @@
 package pg
 
 const (
-	createUser = `INSERT INTO users (id, email, password, role, created_at, updated_at)
+	createUser = `INSERT INTO users (id, email, password, status, created_at, updated_at)
                   VALUES ($1, $2, $3, $4, $5, $6)`
 
-	findByEmail = `SELECT id, email, password, role, created_at, updated_at
-                   FROM users
-                   WHERE email = $1`
+	// selectUser loads the roles of the user and the permissions they grant together with the user.
+	selectUser = `SELECT u.id, u.email, u.password, u.created_at, u.updated_at, u.token_version, u.email_verified_at,
+                  u.mfa_secret, u.mfa_enabled_at, u.status, u.status_reason, u.status_changed_at,
+                  ARRAY(SELECT ur.role
+                        FROM user_roles ur
+                        WHERE ur.user_id = u.id
+                        ORDER BY ur.role) AS roles,
+                  ARRAY(SELECT DISTINCT rp.permission
+                        FROM user_roles ur
+                                 JOIN role_permissions rp ON rp.role = ur.role
+                        WHERE ur.user_id = u.id
+                        ORDER BY rp.permission) AS permissions
+                  FROM users u `
 
-	findById = `SELECT id, email, password, role, created_at, updated_at
-                FROM users
-                WHERE id = $1`
+	findByEmail = selectUser + `WHERE u.email = $1`
+
+	findById = selectUser + `WHERE u.id = $1`
+
+	listUsers = selectUser + `WHERE u.email ILIKE '%' || $1 || '%' AND ($2 = '' OR u.status = $2)
+                              ORDER BY u.created_at DESC, u.id
+                              LIMIT $3 OFFSET $4`
+
+	countUsers = `SELECT count(*)
+                  FROM users
+                  WHERE email ILIKE '%' || $1 || '%' AND ($2 = '' OR status = $2)`
+
+	setUserStatus = `UPDATE users
+                     SET status = $2, status_reason = $3, status_changed_at = $4, updated_at = $4
+                     WHERE id = $1`
+
+	bumpTokenVersion = `UPDATE users
+                        SET token_version = token_version + 1
+                        WHERE id = $1
+                        RETURNING token_version`
+
+	setEmailVerified = `UPDATE users
+                        SET email_verified_at = COALESCE(email_verified_at, $2),
+                            status            = CASE WHEN status = 'pending' THEN 'active' ELSE status END,
+                            status_changed_at = CASE WHEN status = 'pending' THEN $2 ELSE status_changed_at END
+                        WHERE id = $1`
+
+	updatePassword = `UPDATE users
+                      SET password = $2, updated_at = $3
+                      WHERE id = $1`
 )
 
 const (
-	saveToken = `INSERT INTO refresh_tokens (id, user_id, token, expires_at)
-                 VALUES ($1, $2, $3, $4)`
+	saveToken = `INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+                 VALUES ($1, $2, $3, $4, $5, $6)`
 
-	getToken = `SELECT id, user_id, token, expires_at
+	getToken = `SELECT id, user_id, family_id, token_hash, expires_at, created_at, rotated_at, revoked_at
                  FROM refresh_tokens
-                 WHERE token = $1`
+                 WHERE token_hash = $1`
+
+	markTokenRotated = `UPDATE refresh_tokens
+                        SET rotated_at = $2
+                        WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL`
+
+	revokeTokenFamily = `UPDATE refresh_tokens
+                         SET revoked_at = $2
+                         WHERE family_id = $1 AND revoked_at IS NULL`
+
+	deleteToken = `DELETE FROM sessions
+                   WHERE id = (SELECT family_id FROM refresh_tokens WHERE token_hash = $1)`
+
+	deleteUserTokens = `DELETE FROM sessions
+                        WHERE user_id = $1 AND id <> $2`
+)
+
+const (
+	createSession = `INSERT INTO sessions (id, user_id, user_agent, ip, device, created_at, last_used_at)
+                     VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	touchSession = `UPDATE sessions
+                    SET last_used_at = $2
+                    WHERE id = $1`
+
+	listSessions = `SELECT s.id, s.user_id, s.user_agent, s.ip, s.device, s.created_at, s.last_used_at
+                    FROM sessions s
+                    WHERE s.user_id = $1
+                      AND EXISTS (SELECT 1
+                                  FROM refresh_tokens t
+                                  WHERE t.family_id = s.id
+                                    AND t.rotated_at IS NULL
+                                    AND t.revoked_at IS NULL
+                                    AND t.expires_at > $2)
+                    ORDER BY s.last_used_at DESC`
+
+	deleteSession = `DELETE FROM sessions
+                     WHERE id = $1 AND user_id = $2`
+)
+
+const (
+	revokeAccessToken = `INSERT INTO revoked_tokens (jti, expires_at)
+                         VALUES ($1, $2)
+                         ON CONFLICT (jti) DO NOTHING`
+
+	purgeRevokedTokens = `DELETE FROM revoked_tokens
+                          WHERE expires_at <= $1`
+
+	isAccessTokenRevoked = `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1 AND expires_at > $2)`
+)
+
+const (
+	listSigningKeys = `SELECT kid, alg, sealed_key, activates_at, created_at
+                       FROM signing_keys
+                       ORDER BY activates_at`
+
+	saveSigningKey = `INSERT INTO signing_keys (kid, alg, sealed_key, activates_at, created_at)
+                      VALUES ($1, $2, $3, $4, $5)`
+
+	deleteRetiredSigningKeys = `DELETE FROM signing_keys k
+                                WHERE EXISTS (SELECT 1
+                                              FROM signing_keys n
+                                              WHERE n.activates_at > k.activates_at
+                                                AND n.activates_at < $1)`
+)
+
+const (
+	saveResetToken = `INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at, created_at)
+                      VALUES ($1, $2, $3, $4, $5)`
+
+	getResetToken = `SELECT id, user_id, token_hash, expires_at, created_at, used_at
+                     FROM password_reset_tokens
+                     WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2`
+
+	useResetToken = `UPDATE password_reset_tokens
+                     SET used_at = $2
+                     WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+                     RETURNING id, user_id, token_hash, expires_at, created_at, used_at`
+
+	deleteUserResetTokens = `DELETE FROM password_reset_tokens
+                             WHERE user_id = $1 AND (used_at IS NOT NULL OR expires_at <= $2)`
+
+	deleteAllUserResetTokens = `DELETE FROM password_reset_tokens
+                                WHERE user_id = $1`
+)
+
+const (
+	setMFASecret = `UPDATE users
+                    SET mfa_secret = $2
+                    WHERE id = $1 AND mfa_enabled_at IS NULL`
+
+	enableMFA = `UPDATE users
+                 SET mfa_enabled_at = $2
+                 WHERE id = $1 AND mfa_secret <> '' AND mfa_enabled_at IS NULL`
+
+	useMFAStep = `UPDATE users
+                  SET mfa_last_step = $2
+                  WHERE id = $1 AND (mfa_last_step IS NULL OR mfa_last_step < $2)`
+
+	deleteRecoveryCodes = `DELETE FROM mfa_recovery_codes
+                           WHERE user_id = $1`
+
+	saveRecoveryCode = `INSERT INTO mfa_recovery_codes (id, user_id, code_hash, created_at)
+                        VALUES ($1, $2, $3, $4)`
+
+	useRecoveryCode = `UPDATE mfa_recovery_codes
+                       SET used_at = $3
+                       WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+)
+
+const (
+	listRoles = `SELECT r.name, r.description, r.created_at,
+                 ARRAY(SELECT rp.permission
+                       FROM role_permissions rp
+                       WHERE rp.role = r.name
+                       ORDER BY rp.permission) AS permissions
+                 FROM roles r
+                 ORDER BY r.name`
+
+	createRole = `INSERT INTO roles (name, description, created_at)
+                  VALUES ($1, $2, $3)`
+
+	lockRole = `SELECT name
+                FROM roles
+                WHERE name = $1
+                FOR UPDATE`
+
+	deleteRole = `DELETE FROM roles
+                  WHERE name = $1`
+
+	bumpRoleHolderTokenVersions = `UPDATE users
+                                   SET token_version = token_version + 1
+                                   WHERE id IN (SELECT user_id FROM user_roles WHERE role = $1)`
+
+	deleteRolePermissions = `DELETE FROM role_permissions
+                             WHERE role = $1`
+
+	addRolePermission = `INSERT INTO role_permissions (role, permission)
+                         VALUES ($1, $2)
+                         ON CONFLICT DO NOTHING`
+
+	listPermissions = `SELECT name, description
+                       FROM permissions
+                       ORDER BY name`
+
+	assignRole = `INSERT INTO user_roles (user_id, role, created_at)
+                  VALUES ($1, $2, $3)
+                  ON CONFLICT DO NOTHING`
+
+	unassignRole = `DELETE FROM user_roles
+                    WHERE user_id = $1 AND role = $2`
+
+	deleteUserRoles = `DELETE FROM user_roles
+                       WHERE user_id = $1`
+)
+
+const (
+	selectOAuthClient = `SELECT id, name, redirect_uris, scopes, grant_types, COALESCE(secret_hash, ''), created_at
+                         FROM oauth_clients`
+
+	getOAuthClient = selectOAuthClient + ` WHERE id = $1`
+
+	listOAuthClients = selectOAuthClient + ` ORDER BY created_at`
+
+	createOAuthClient = `INSERT INTO oauth_clients (id, name, redirect_uris, scopes, grant_types, secret_hash, created_at)
+                         VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)`
+
+	setOAuthClientSecret = `UPDATE oauth_clients
+                            SET secret_hash = $2
+                            WHERE id = $1`
+
+	deleteOAuthClient = `DELETE FROM oauth_clients
+                         WHERE id = $1`
+
+	saveAuthorizationCode = `INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes,
+                                                                    code_challenge, nonce, auth_time, expires_at,
+                                                                    created_at)
+                             VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	purgeAuthorizationCodes = `DELETE FROM oauth_authorization_codes
+                               WHERE expires_at <= $1`
+
+	useAuthorizationCode = `UPDATE oauth_authorization_codes
+                            SET used_at = $2
+                            WHERE code_hash = $1 AND used_at IS NULL AND expires_at > $2
+                            RETURNING code_hash, client_id, user_id, redirect_uri, scopes, code_challenge,
+                                      nonce, auth_time, expires_at, created_at, used_at`
+)
+
+const (
+	getLoginAttempt = `SELECT key, failures, last_failure_at
+                       FROM login_attempts
+                       WHERE key = $1`
+
+	recordLoginFailure = `INSERT INTO login_attempts (key, failures, last_failure_at)
+                          VALUES ($1, 1, $2)
+                          ON CONFLICT (key) DO UPDATE
+                              SET failures        = CASE
+                                                        WHEN login_attempts.last_failure_at < $3 THEN 1
+                                                        ELSE login_attempts.failures + 1
+                                                    END,
+                                  last_failure_at = $2
+                          RETURNING key, failures, last_failure_at`
+
+	forgiveLoginFailure = `UPDATE login_attempts
+                           SET failures = failures - 1
+                           WHERE key = $1 AND failures > 0`
+
+	resetLoginFailures = `DELETE FROM login_attempts
+                          WHERE key = $1`
 
-	deleteToken = `DELETE FROM refresh_tokens
-                   WHERE token = $1`
+	purgeLoginAttempts = `DELETE FROM login_attempts
+                          WHERE last_failure_at < $1`
 )
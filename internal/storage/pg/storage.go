@@ -3,6 +3,7 @@ package pg
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,6 +17,14 @@ import (
 	"github.com/sanchey92/jwt-example/internal/models"
 )
 
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// likeEscaper makes user input match literally inside a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 type Storage struct {
 	db  *pgxpool.Pool
 	log *zap.Logger
@@ -75,52 +84,202 @@ func (s *Storage) Close() error {
 	return nil
 }
 
+// Create saves the user together with its roles in one transaction.
 func (s *Storage) Create(ctx context.Context, user *models.User) error {
-	_, err := s.db.Exec(ctx, createUser, user.ID, user.Email, user.Password, user.Role, user.CreatedAt, user.UpdatedAt)
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, createUser, user.ID, user.Email, user.Password, user.Status, user.CreatedAt, user.UpdatedAt)
 	if err != nil {
-		var pgxErr *pgconn.PgError
-		if errors.As(err, &pgxErr) && pgxErr.Code == "23505" {
+		if pgErrorCode(err) == uniqueViolation {
 			return appError.ErrUserAlreadyExists
 		}
 		return err
 	}
-	return nil
+
+	for _, role := range user.Roles {
+		if _, err = tx.Exec(ctx, assignRole, user.ID, role, user.CreatedAt); err != nil {
+			if pgErrorCode(err) == foreignKeyViolation {
+				return appError.ErrRoleNotFound
+			}
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
 }
 
 func (s *Storage) FindByEmail(ctx context.Context, email string) (*models.User, error) {
-	var user models.User
-	err := s.db.QueryRow(ctx, findByEmail, email).
-		Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	user, err := scanUser(s.db.QueryRow(ctx, findByEmail, email))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, appError.ErrUserNotFound
 		}
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
 }
 
 func (s *Storage) FindByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
-	var user models.User
-	err := s.db.QueryRow(ctx, findById, id).
-		Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+	user, err := scanUser(s.db.QueryRow(ctx, findById, id))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, appError.ErrUserNotFound
 		}
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
+}
+
+// ListUsers returns a page of users matching the filter, newest first, and the number of all matches.
+func (s *Storage) ListUsers(ctx context.Context, filter models.UserFilter) ([]models.User, int, error) {
+	pattern := likeEscaper.Replace(filter.Email)
+
+	var total int
+	if err := s.db.QueryRow(ctx, countUsers, pattern, filter.Status).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(ctx, listUsers, pattern, filter.Status, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0, filter.Limit)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *user)
+	}
+
+	return users, total, rows.Err()
 }
 
-func (s *Storage) SaveToken(ctx context.Context, token *models.RefreshToken) error {
-	_, err := s.db.Exec(ctx, saveToken, token.ID, token.UserID, token.Token, token.ExpiresAt)
+// SetStatus changes the status of the user, reason is kept as the admin's note.
+func (s *Storage) SetStatus(ctx context.Context, id uuid.UUID, status models.UserStatus, reason string, changedAt time.Time) error {
+	tag, err := s.db.Exec(ctx, setUserStatus, id, status, reason, changedAt)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return appError.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// BumpTokenVersion invalidates the access tokens of the user and returns the new version.
+func (s *Storage) BumpTokenVersion(ctx context.Context, id uuid.UUID) (int64, error) {
+	var version int64
+	if err := s.db.QueryRow(ctx, bumpTokenVersion, id).Scan(&version); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, appError.ErrUserNotFound
+		}
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// SetEmailVerified keeps the time of the first verification when a link is opened again. A pending
+// account becomes active.
+func (s *Storage) SetEmailVerified(ctx context.Context, id uuid.UUID, verifiedAt time.Time) error {
+	_, err := s.db.Exec(ctx, setEmailVerified, id, verifiedAt)
 	return err
 }
 
-func (s *Storage) GetToken(ctx context.Context, token string) (*models.RefreshToken, error) {
+func (s *Storage) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string, updatedAt time.Time) error {
+	_, err := s.db.Exec(ctx, updatePassword, id, passwordHash, updatedAt)
+	return err
+}
+
+// ChangePassword stores the new password hash, ends every session except keepSessionID, invalidates the
+// access tokens and deletes outstanding password reset tokens, all or nothing. It returns the new
+// token version.
+func (s *Storage) ChangePassword(
+	ctx context.Context,
+	id uuid.UUID,
+	passwordHash string,
+	keepSessionID uuid.UUID,
+	changedAt time.Time,
+) (int64, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, updatePassword, id, passwordHash, changedAt); err != nil {
+		return 0, err
+	}
+
+	if _, err = tx.Exec(ctx, deleteUserTokens, id, keepSessionID); err != nil {
+		return 0, err
+	}
+
+	var version int64
+	if err = tx.QueryRow(ctx, bumpTokenVersion, id).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	if _, err = tx.Exec(ctx, deleteAllUserResetTokens, id); err != nil {
+		return 0, err
+	}
+
+	return version, tx.Commit(ctx)
+}
+
+// ResetPassword redeems the reset token and sets the new password of its user in one transaction:
+// every session is ended and the other reset tokens of the user are deleted. The token is marked
+// used in the same statement that checks it, so it can be redeemed only once. It returns
+// ErrInvalidToken for unknown, used or expired tokens.
+func (s *Storage) ResetPassword(ctx context.Context, tokenHash, passwordHash string, resetAt time.Time) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var t models.PasswordResetToken
+	err = tx.QueryRow(ctx, useResetToken, tokenHash, resetAt).
+		Scan(&t.ID, &t.UserID, &t.TokenHash, &t.ExpiresAt, &t.CreatedAt, &t.UsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return appError.ErrInvalidToken
+		}
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, updatePassword, t.UserID, passwordHash, resetAt); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, deleteUserTokens, t.UserID, uuid.Nil); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, bumpTokenVersion, t.UserID); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, deleteAllUserResetTokens, t.UserID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *Storage) GetToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
 	var t models.RefreshToken
-	err := s.db.QueryRow(ctx, getToken, token).Scan(&t.ID, &t.UserID, &t.Token, &t.ExpiresAt)
+	err := s.db.QueryRow(ctx, getToken, tokenHash).
+		Scan(&t.ID, &t.UserID, &t.FamilyID, &t.TokenHash, &t.ExpiresAt, &t.CreatedAt, &t.RotatedAt, &t.RevokedAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, appError.ErrInvalidToken
@@ -131,7 +290,604 @@ func (s *Storage) GetToken(ctx context.Context, token string) (*models.RefreshTo
 	return &t, nil
 }
 
-func (s *Storage) DeleteToken(ctx context.Context, token string) error {
-	_, err := s.db.Exec(ctx, deleteToken, token)
+// RotateToken marks the old token as rotated and saves its successor in one transaction.
+// It returns ErrTokenReused when the old token was already rotated or revoked.
+func (s *Storage) RotateToken(ctx context.Context, oldID uuid.UUID, next *models.RefreshToken) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, markTokenRotated, oldID, next.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return appError.ErrTokenReused
+	}
+
+	_, err = tx.Exec(ctx, saveToken,
+		next.ID, next.UserID, next.FamilyID, next.TokenHash, next.ExpiresAt, next.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, touchSession, next.FamilyID, next.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *Storage) RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := s.db.Exec(ctx, revokeTokenFamily, familyID, time.Now())
+	return err
+}
+
+// DeleteToken removes the session of the token with all its refresh tokens, so older rotated
+// tokens cannot be replayed.
+func (s *Storage) DeleteToken(ctx context.Context, tokenHash string) error {
+	_, err := s.db.Exec(ctx, deleteToken, tokenHash)
 	return err
 }
+
+// DeleteUserTokens deletes all sessions of the user except the given one (uuid.Nil keeps none).
+func (s *Storage) DeleteUserTokens(ctx context.Context, userID, exceptFamilyID uuid.UUID) error {
+	_, err := s.db.Exec(ctx, deleteUserTokens, userID, exceptFamilyID)
+	return err
+}
+
+// CreateSession saves the session together with its first refresh token.
+func (s *Storage) CreateSession(ctx context.Context, session *models.Session, token *models.RefreshToken) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, createSession, session.ID, session.UserID, session.UserAgent, session.IP,
+		session.Device, session.CreatedAt, session.LastUsedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, saveToken,
+		token.ID, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ListSessions returns the sessions of the user that still hold a usable refresh token.
+func (s *Storage) ListSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	rows, err := s.db.Query(ctx, listSessions, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]models.Session, 0)
+	for rows.Next() {
+		var session models.Session
+		err = rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.Device,
+			&session.CreatedAt, &session.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (s *Storage) DeleteSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	tag, err := s.db.Exec(ctx, deleteSession, sessionID, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return appError.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeAccessToken adds the token ID to the denylist and drops entries of tokens that expired meanwhile.
+func (s *Storage) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if _, err := s.db.Exec(ctx, revokeAccessToken, jti, expiresAt); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec(ctx, purgeRevokedTokens, time.Now())
+	return err
+}
+
+func (s *Storage) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := s.db.QueryRow(ctx, isAccessTokenRevoked, jti, time.Now()).Scan(&revoked)
+	return revoked, err
+}
+
+// ListSigningKeys returns the keys created by scheduled rotation, oldest first.
+func (s *Storage) ListSigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	rows, err := s.db.Query(ctx, listSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.SigningKey
+	for rows.Next() {
+		var k models.SigningKey
+		if err = rows.Scan(&k.KeyID, &k.Algorithm, &k.SealedKey, &k.ActivatesAt, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *Storage) SaveSigningKey(ctx context.Context, key *models.SigningKey) error {
+	_, err := s.db.Exec(ctx, saveSigningKey, key.KeyID, key.Algorithm, key.SealedKey, key.ActivatesAt, key.CreatedAt)
+	return err
+}
+
+// DeleteRetiredSigningKeys drops the keys whose successor activated before the given time.
+func (s *Storage) DeleteRetiredSigningKeys(ctx context.Context, before time.Time) error {
+	_, err := s.db.Exec(ctx, deleteRetiredSigningKeys, before)
+	return err
+}
+
+// SaveResetToken stores a new password reset token and drops used or expired tokens of the user.
+func (s *Storage) SaveResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	_, err := s.db.Exec(ctx, saveResetToken, token.ID, token.UserID, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(ctx, deleteUserResetTokens, token.UserID, token.CreatedAt)
+	return err
+}
+
+// GetResetToken returns the token while it is unused and not expired, ErrInvalidToken otherwise.
+func (s *Storage) GetResetToken(ctx context.Context, tokenHash string, now time.Time) (*models.PasswordResetToken, error) {
+	var t models.PasswordResetToken
+	err := s.db.QueryRow(ctx, getResetToken, tokenHash, now).
+		Scan(&t.ID, &t.UserID, &t.TokenHash, &t.ExpiresAt, &t.CreatedAt, &t.UsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, appError.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// SetMFASecret stores the secret of a pending enrollment. It returns ErrMFAAlreadyEnabled once MFA
+// is confirmed, so an enabled secret is never replaced.
+func (s *Storage) SetMFASecret(ctx context.Context, id uuid.UUID, secret string) error {
+	tag, err := s.db.Exec(ctx, setMFASecret, id, secret)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return appError.ErrMFAAlreadyEnabled
+	}
+
+	return nil
+}
+
+// EnableMFA confirms the pending enrollment and replaces the recovery codes in one transaction.
+func (s *Storage) EnableMFA(ctx context.Context, id uuid.UUID, enabledAt time.Time, codes []models.RecoveryCode) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, enableMFA, id, enabledAt)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return appError.ErrMFAAlreadyEnabled
+	}
+
+	if _, err = tx.Exec(ctx, deleteRecoveryCodes, id); err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		if _, err = tx.Exec(ctx, saveRecoveryCode, code.ID, code.UserID, code.CodeHash, code.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UseMFAStep records the time step of an accepted TOTP code. It returns ErrMFACodeReused when this
+// or a later step was already used, so an observed code cannot be replayed.
+func (s *Storage) UseMFAStep(ctx context.Context, id uuid.UUID, step int64) error {
+	tag, err := s.db.Exec(ctx, useMFAStep, id, step)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return appError.ErrMFACodeReused
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consumes a recovery code. It returns ErrInvalidMFACode for unknown or used codes.
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, usedAt time.Time) error {
+	tag, err := s.db.Exec(ctx, useRecoveryCode, userID, codeHash, usedAt)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return appError.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// GetLoginAttempt returns nil when the key has no recorded failures.
+func (s *Storage) GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	var a models.LoginAttempt
+	err := s.db.QueryRow(ctx, getLoginAttempt, key).Scan(&a.Key, &a.Failures, &a.LastFailureAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// RecordLoginFailure increments the failure counter of the key and returns it from the same statement,
+// so concurrent failures never read the same count. Counters whose last failure happened before
+// resetBefore start again from one; those of other keys are dropped.
+func (s *Storage) RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (*models.LoginAttempt, error) {
+	var a models.LoginAttempt
+	err := s.db.QueryRow(ctx, recordLoginFailure, key, at, resetBefore).Scan(&a.Key, &a.Failures, &a.LastFailureAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = s.db.Exec(ctx, purgeLoginAttempts, resetBefore); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (s *Storage) ForgiveLoginFailure(ctx context.Context, key string) error {
+	_, err := s.db.Exec(ctx, forgiveLoginFailure, key)
+	return err
+}
+
+func (s *Storage) ResetLoginFailures(ctx context.Context, key string) error {
+	_, err := s.db.Exec(ctx, resetLoginFailures, key)
+	return err
+}
+
+// ListRoles returns all roles with the permissions they grant.
+func (s *Storage) ListRoles(ctx context.Context) ([]models.RoleDefinition, error) {
+	rows, err := s.db.Query(ctx, listRoles)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]models.RoleDefinition, 0)
+	for rows.Next() {
+		var role models.RoleDefinition
+		if err = rows.Scan(&role.Name, &role.Description, &role.CreatedAt, &role.Permissions); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// CreateRole saves the role with its permissions. It returns ErrRoleAlreadyExists for a taken name
+// and ErrUnknownPermission when a permission does not exist.
+func (s *Storage) CreateRole(ctx context.Context, role *models.RoleDefinition) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, createRole, role.Name, role.Description, role.CreatedAt); err != nil {
+		if pgErrorCode(err) == uniqueViolation {
+			return appError.ErrRoleAlreadyExists
+		}
+		return err
+	}
+
+	if err = addRolePermissions(ctx, tx, role.Name, role.Permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteRole removes the role and invalidates the access tokens of its holders in one transaction,
+// the holders are looked up before the assignments cascade away.
+func (s *Storage) DeleteRole(ctx context.Context, name models.Role) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, bumpRoleHolderTokenVersions, name); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, deleteRole, name)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return appError.ErrRoleNotFound
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SetRolePermissions replaces the permissions of the role and invalidates the access tokens of its
+// holders in one transaction.
+func (s *Storage) SetRolePermissions(ctx context.Context, name models.Role, permissions []models.Permission) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var locked models.Role
+	if err = tx.QueryRow(ctx, lockRole, name).Scan(&locked); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return appError.ErrRoleNotFound
+		}
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, deleteRolePermissions, name); err != nil {
+		return err
+	}
+
+	if err = addRolePermissions(ctx, tx, name, permissions); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, bumpRoleHolderTokenVersions, name); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *Storage) ListPermissions(ctx context.Context) ([]models.PermissionDefinition, error) {
+	rows, err := s.db.Query(ctx, listPermissions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := make([]models.PermissionDefinition, 0)
+	for rows.Next() {
+		var permission models.PermissionDefinition
+		if err = rows.Scan(&permission.Name, &permission.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+// AssignRole gives the user the role, assigning a role the user already has is a no-op.
+// It returns ErrRoleNotFound when the role does not exist.
+func (s *Storage) AssignRole(ctx context.Context, userID uuid.UUID, role models.Role, at time.Time) error {
+	if _, err := s.db.Exec(ctx, assignRole, userID, role, at); err != nil {
+		if pgErrorCode(err) == foreignKeyViolation {
+			return appError.ErrRoleNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// UnassignRole takes the role away from the user. It returns ErrRoleNotAssigned when the user does not have it.
+func (s *Storage) UnassignRole(ctx context.Context, userID uuid.UUID, role models.Role) error {
+	tag, err := s.db.Exec(ctx, unassignRole, userID, role)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return appError.ErrRoleNotAssigned
+	}
+
+	return nil
+}
+
+// SetUserRoles replaces the roles of the user in one transaction. It returns ErrRoleNotFound when
+// one of the roles does not exist.
+func (s *Storage) SetUserRoles(ctx context.Context, userID uuid.UUID, roles []models.Role, at time.Time) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, deleteUserRoles, userID); err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		if _, err = tx.Exec(ctx, assignRole, userID, role, at); err != nil {
+			if pgErrorCode(err) == foreignKeyViolation {
+				return appError.ErrRoleNotFound
+			}
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func addRolePermissions(ctx context.Context, tx pgx.Tx, role models.Role, permissions []models.Permission) error {
+	for _, permission := range permissions {
+		if _, err := tx.Exec(ctx, addRolePermission, role, permission); err != nil {
+			if pgErrorCode(err) == foreignKeyViolation {
+				return appError.ErrUnknownPermission
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) GetOAuthClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	client, err := scanOAuthClient(s.db.QueryRow(ctx, getOAuthClient, clientID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, appError.ErrOAuthClientNotFound
+		}
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (s *Storage) ListOAuthClients(ctx context.Context) ([]models.OAuthClient, error) {
+	rows, err := s.db.Query(ctx, listOAuthClients)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := make([]models.OAuthClient, 0)
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+
+	return clients, rows.Err()
+}
+
+func (s *Storage) CreateOAuthClient(ctx context.Context, client *models.OAuthClient) error {
+	_, err := s.db.Exec(ctx, createOAuthClient, client.ID, client.Name, client.RedirectURIs, client.Scopes,
+		client.GrantTypes, client.SecretHash, client.CreatedAt)
+	return err
+}
+
+func (s *Storage) SetOAuthClientSecret(ctx context.Context, clientID, secretHash string) error {
+	tag, err := s.db.Exec(ctx, setOAuthClientSecret, clientID, secretHash)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return appError.ErrOAuthClientNotFound
+	}
+
+	return nil
+}
+
+// DeleteOAuthClient removes the client together with its unused authorization codes.
+func (s *Storage) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	tag, err := s.db.Exec(ctx, deleteOAuthClient, clientID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return appError.ErrOAuthClientNotFound
+	}
+
+	return nil
+}
+
+// SaveAuthorizationCode stores a new code and drops expired ones.
+func (s *Storage) SaveAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	_, err := s.db.Exec(ctx, saveAuthorizationCode, code.CodeHash, code.ClientID, code.UserID, code.RedirectURI,
+		code.Scopes, code.CodeChallenge, code.Nonce, code.AuthTime, code.ExpiresAt, code.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(ctx, purgeAuthorizationCodes, code.CreatedAt)
+	return err
+}
+
+// UseAuthorizationCode marks the code as used in the same statement that checks it, so a code can
+// be exchanged only once. It returns ErrInvalidToken for unknown, used or expired codes.
+func (s *Storage) UseAuthorizationCode(ctx context.Context, codeHash string, usedAt time.Time) (*models.AuthorizationCode, error) {
+	var c models.AuthorizationCode
+	err := s.db.QueryRow(ctx, useAuthorizationCode, codeHash, usedAt).
+		Scan(&c.CodeHash, &c.ClientID, &c.UserID, &c.RedirectURI, &c.Scopes, &c.CodeChallenge,
+			&c.Nonce, &c.AuthTime, &c.ExpiresAt, &c.CreatedAt, &c.UsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, appError.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func scanOAuthClient(row pgx.Row) (*models.OAuthClient, error) {
+	var c models.OAuthClient
+	err := row.Scan(&c.ID, &c.Name, &c.RedirectURIs, &c.Scopes, &c.GrantTypes, &c.SecretHash, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Confidential = c.SecretHash != ""
+	return &c, nil
+}
+
+func scanUser(row pgx.Row) (*models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.TokenVersion,
+		&user.EmailVerifiedAt, &user.MFASecret, &user.MFAEnabledAt, &user.Status, &user.StatusReason, &user.StatusChangedAt,
+		&user.Roles, &user.Permissions)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func pgErrorCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
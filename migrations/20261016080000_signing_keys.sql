@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE signing_keys
+(
+    kid          TEXT PRIMARY KEY,
+    alg          TEXT      NOT NULL,
+    sealed_key   BYTEA     NOT NULL,
+    activates_at TIMESTAMP NOT NULL,
+    created_at   TIMESTAMP NOT NULL
+);
+
+CREATE INDEX signing_keys_activates_at_idx ON signing_keys (activates_at);
+
+-- +goose Down
+DROP TABLE signing_keys;
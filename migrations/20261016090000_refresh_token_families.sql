@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+    ADD COLUMN family_id  UUID,
+    ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT now(),
+    ADD COLUMN rotated_at TIMESTAMP,
+    ADD COLUMN revoked_at TIMESTAMP;
+
+-- Every existing token starts its own family.
+UPDATE refresh_tokens
+SET family_id = id;
+
+ALTER TABLE refresh_tokens
+    ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_family_id_idx;
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN family_id,
+    DROP COLUMN created_at,
+    DROP COLUMN rotated_at,
+    DROP COLUMN revoked_at;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Refresh tokens are stored as HMAC-SHA256 hashes keyed with JWT_REFRESH_SECRET. The key is not known
+-- to the database, so existing plaintext tokens cannot be hashed here: they are revoked instead and
+-- their users sign in again.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN token,
+    ADD COLUMN token_hash TEXT UNIQUE NOT NULL;
+
+-- +goose Down
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN token_hash,
+    ADD COLUMN token TEXT UNIQUE NOT NULL;
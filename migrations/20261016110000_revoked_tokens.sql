@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE revoked_tokens
+(
+    jti        TEXT PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX revoked_tokens_expires_at_idx ON revoked_tokens (expires_at);
+
+-- +goose Down
+DROP TABLE revoked_tokens;
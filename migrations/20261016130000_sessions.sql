@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE sessions
+(
+    id           UUID PRIMARY KEY,
+    user_id      UUID      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_agent   TEXT      NOT NULL DEFAULT '',
+    ip           TEXT      NOT NULL DEFAULT '',
+    device       TEXT      NOT NULL DEFAULT '',
+    created_at   TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+-- A session is a refresh token family, existing families become sessions without client details.
+INSERT INTO sessions (id, user_id, created_at, last_used_at)
+SELECT family_id, user_id, MIN(created_at), MAX(created_at)
+FROM refresh_tokens
+GROUP BY family_id, user_id;
+
+ALTER TABLE refresh_tokens
+    ADD CONSTRAINT refresh_tokens_family_id_fkey
+        FOREIGN KEY (family_id) REFERENCES sessions (id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+    DROP CONSTRAINT refresh_tokens_family_id_fkey;
+
+DROP TABLE sessions;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Existing accounts stay unverified, with REQUIRE_EMAIL_VERIFICATION they have to request a new link.
+ALTER TABLE users
+    ADD COLUMN email_verified_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN email_verified_at;
@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN mfa_secret     TEXT NOT NULL DEFAULT '',
+    ADD COLUMN mfa_enabled_at TIMESTAMP,
+    ADD COLUMN mfa_last_step  BIGINT;
+
+CREATE TABLE mfa_recovery_codes
+(
+    id         UUID PRIMARY KEY,
+    user_id    UUID      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash  TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    used_at    TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
+
+-- +goose Down
+DROP TABLE mfa_recovery_codes;
+
+ALTER TABLE users
+    DROP COLUMN mfa_last_step,
+    DROP COLUMN mfa_enabled_at,
+    DROP COLUMN mfa_secret;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE login_attempts
+(
+    key             TEXT PRIMARY KEY,
+    failures        INT       NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX login_attempts_last_failure_at_idx ON login_attempts (last_failure_at);
+
+-- +goose Down
+DROP TABLE login_attempts;
@@ -0,0 +1,73 @@
+-- +goose Up
+CREATE TABLE roles
+(
+    name        TEXT PRIMARY KEY,
+    description TEXT      NOT NULL DEFAULT '',
+    created_at  TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE permissions
+(
+    name        TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE role_permissions
+(
+    role       TEXT NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    permission TEXT NOT NULL REFERENCES permissions (name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE user_roles
+(
+    user_id    UUID      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role       TEXT      NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE INDEX user_roles_role_idx ON user_roles (role);
+
+INSERT INTO roles (name, description)
+VALUES ('admin', 'Manages users and roles'),
+       ('user', 'Default role of registered users');
+
+INSERT INTO permissions (name, description)
+VALUES ('users:read', 'List and view users'),
+       ('users:write', 'Change users'),
+       ('users:unlock', 'Lift the lockout of an account'),
+       ('roles:read', 'List roles and permissions'),
+       ('roles:write', 'Manage roles and assign them to users');
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', name
+FROM permissions;
+
+INSERT INTO roles (name)
+SELECT DISTINCT role
+FROM users
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO user_roles (user_id, role, created_at)
+SELECT id, role, created_at
+FROM users;
+
+ALTER TABLE users
+    DROP COLUMN role;
+
+-- +goose Down
+ALTER TABLE users
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+
+UPDATE users u
+SET role = 'admin'
+WHERE EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = u.id AND ur.role = 'admin');
+
+ALTER TABLE users
+    ALTER COLUMN role DROP DEFAULT;
+
+DROP TABLE user_roles;
+DROP TABLE role_permissions;
+DROP TABLE permissions;
+DROP TABLE roles;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN disabled_at TIMESTAMP;
+
+CREATE INDEX users_created_at_idx ON users (created_at DESC, id);
+
+-- +goose Down
+DROP INDEX users_created_at_idx;
+
+ALTER TABLE users
+    DROP COLUMN disabled_at;
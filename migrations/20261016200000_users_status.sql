@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN status            TEXT NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'suspended', 'pending', 'deleted')),
+    ADD COLUMN status_reason     TEXT NOT NULL DEFAULT '',
+    ADD COLUMN status_changed_at TIMESTAMP;
+
+UPDATE users
+SET status            = 'suspended',
+    status_changed_at = disabled_at
+WHERE disabled_at IS NOT NULL;
+
+ALTER TABLE users
+    DROP COLUMN disabled_at;
+
+-- +goose Down
+ALTER TABLE users
+    ADD COLUMN disabled_at TIMESTAMP;
+
+UPDATE users
+SET disabled_at = COALESCE(status_changed_at, now())
+WHERE status IN ('suspended', 'deleted');
+
+ALTER TABLE users
+    DROP COLUMN status_changed_at,
+    DROP COLUMN status_reason,
+    DROP COLUMN status;
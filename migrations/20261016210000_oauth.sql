@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE oauth_clients
+(
+    id            TEXT PRIMARY KEY,
+    name          TEXT      NOT NULL,
+    redirect_uris TEXT[]    NOT NULL DEFAULT '{}',
+    scopes        TEXT[]    NOT NULL DEFAULT '{}',
+    created_at    TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE oauth_authorization_codes
+(
+    code_hash      TEXT PRIMARY KEY,
+    client_id      TEXT      NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    user_id        UUID      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri   TEXT      NOT NULL,
+    scopes         TEXT[]    NOT NULL,
+    code_challenge TEXT      NOT NULL,
+    expires_at     TIMESTAMP NOT NULL,
+    created_at     TIMESTAMP NOT NULL,
+    used_at        TIMESTAMP
+);
+
+CREATE INDEX oauth_authorization_codes_expires_at_idx ON oauth_authorization_codes (expires_at);
+
+-- +goose Down
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE oauth_clients
+    ADD COLUMN secret_hash TEXT,
+    ADD COLUMN grant_types TEXT[] NOT NULL DEFAULT '{authorization_code}';
+
+ALTER TABLE oauth_clients
+    ALTER COLUMN grant_types DROP DEFAULT;
+
+INSERT INTO permissions (name, description)
+VALUES ('clients:read', 'List and view OAuth clients'),
+       ('clients:write', 'Register OAuth clients and manage their secrets');
+
+INSERT INTO role_permissions (role, permission)
+VALUES ('admin', 'clients:read'),
+       ('admin', 'clients:write');
+
+-- +goose Down
+DELETE FROM permissions
+WHERE name IN ('clients:read', 'clients:write');
+
+ALTER TABLE oauth_clients
+    DROP COLUMN grant_types,
+    DROP COLUMN secret_hash;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE oauth_authorization_codes
+    ADD COLUMN nonce     TEXT      NOT NULL DEFAULT '',
+    ADD COLUMN auth_time TIMESTAMP NOT NULL DEFAULT now();
+
+ALTER TABLE oauth_authorization_codes
+    ALTER COLUMN nonce DROP DEFAULT,
+    ALTER COLUMN auth_time DROP DEFAULT;
+
+-- +goose Down
+ALTER TABLE oauth_authorization_codes
+    DROP COLUMN auth_time,
+    DROP COLUMN nonce;
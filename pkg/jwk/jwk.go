@@ -0,0 +1,135 @@
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+var (
+	ErrUnsupportedKey = errors.New("unsupported public key type")
+	ErrInvalidKey     = errors.New("invalid json web key")
+)
+
+// Key is a public JSON Web Key (RFC 7517) for RSA, P-256 ECDSA or Ed25519 keys.
+type Key struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// New encodes a public key as a signature verification JWK.
+func New(kid, alg string, publicKey crypto.PublicKey) (Key, error) {
+	key := Key{Kid: kid, Alg: alg, Use: "sig"}
+
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		key.Kty = "RSA"
+		key.N = encode(pub.N.Bytes())
+		key.E = encode(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return Key{}, ErrUnsupportedKey
+		}
+		key.Kty = "EC"
+		key.Crv = "P-256"
+		key.X = encode(pub.X.FillBytes(make([]byte, 32)))
+		key.Y = encode(pub.Y.FillBytes(make([]byte, 32)))
+	case ed25519.PublicKey:
+		key.Kty = "OKP"
+		key.Crv = "Ed25519"
+		key.X = encode(pub)
+	default:
+		return Key{}, ErrUnsupportedKey
+	}
+
+	return key, nil
+}
+
+// PublicKey decodes the JWK back into a crypto public key.
+func (k Key) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, ErrInvalidKey
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, ErrUnsupportedKey
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if _, err = pub.ECDH(); err != nil {
+			return nil, ErrInvalidKey
+		}
+		return pub, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, ErrUnsupportedKey
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidKey
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// Find returns the key with the given kid.
+func (s Set) Find(kid string) (Key, bool) {
+	for _, k := range s.Keys {
+		if k.Kid == kid {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, ErrInvalidKey
+	}
+	return b, nil
+}
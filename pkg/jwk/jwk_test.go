@@ -0,0 +1,74 @@
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		alg       string
+		publicKey crypto.PublicKey
+		kty       string
+	}{
+		{name: "RSA", alg: "RS256", publicKey: rsaKey.Public(), kty: "RSA"},
+		{name: "EC", alg: "ES256", publicKey: ecKey.Public(), kty: "EC"},
+		{name: "Ed25519", alg: "EdDSA", publicKey: edPublic, kty: "OKP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := New("kid-1", tt.alg, tt.publicKey)
+			require.NoError(t, err)
+			assert.Equal(t, tt.kty, key.Kty)
+			assert.Equal(t, "sig", key.Use)
+
+			data, err := json.Marshal(Set{Keys: []Key{key}})
+			require.NoError(t, err)
+
+			var set Set
+			require.NoError(t, json.Unmarshal(data, &set))
+
+			found, ok := set.Find("kid-1")
+			require.True(t, ok)
+
+			decoded, err := found.PublicKey()
+			require.NoError(t, err)
+			assert.True(t, decoded.(interface{ Equal(crypto.PublicKey) bool }).Equal(tt.publicKey))
+		})
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	_, err = New("kid", "ES384", ecKey.Public())
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+
+	_, err = Key{Kty: "EC", Crv: "P-256", X: "AQ", Y: "AQ"}.PublicKey()
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = Key{Kty: "OKP", Crv: "Ed25519", X: "AQ"}.PublicKey()
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	_, err = Key{Kty: "oct"}.PublicKey()
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+}
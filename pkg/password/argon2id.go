@@ -0,0 +1,106 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2idPrefix = "$argon2id$"
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// Argon2Params are the cost parameters of argon2id. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultArgon2Params is the second recommended option of RFC 9106 for memory constrained environments.
+var DefaultArgon2Params = Argon2Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 4}
+
+// Argon2id hashes passwords with argon2id into PHC strings like
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>.
+type Argon2id struct {
+	params Argon2Params
+}
+
+func NewArgon2id(params Argon2Params) *Argon2id {
+	return &Argon2id{params: params}
+}
+
+func (a *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	p := a.params
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, p.Memory, p.Iterations,
+		p.Parallelism, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *Argon2id) Verify(password, encoded string) (bool, error) {
+	return Verify(password, encoded)
+}
+
+// NeedsRehash reports hashes of other algorithms or with other parameters.
+func (a *Argon2id) NeedsRehash(encoded string) bool {
+	params, _, key, err := decodeArgon2id(encoded)
+	return err != nil || params != a.params || len(key) != argon2KeyLength
+}
+
+func verifyArgon2id(password, encoded string) (bool, error) {
+	p, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	actual := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,68 @@
+package password
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptMaxBytes is the longest password bcrypt can hash, set it as Policy.MaxBytes when hashing
+// with bcrypt so longer passwords are refused as invalid input.
+const BcryptMaxBytes = 72
+
+// Bcrypt hashes passwords with bcrypt. Passwords longer than BcryptMaxBytes are rejected, because
+// bcrypt would silently ignore the rest.
+type Bcrypt struct {
+	cost int
+}
+
+func NewBcrypt(cost int) *Bcrypt {
+	return &Bcrypt{cost: cost}
+}
+
+func (b *Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (b *Bcrypt) Verify(password, encoded string) (bool, error) {
+	return Verify(password, encoded)
+}
+
+// NeedsRehash reports hashes of other algorithms or of another cost.
+func (b *Bcrypt) NeedsRehash(encoded string) bool {
+	if !isBcrypt(encoded) {
+		return true
+	}
+
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != b.cost
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// verifyBcrypt does not match passwords bcrypt cannot hash; only hashes made by libraries that
+// truncated could, and accepting them would accept every password sharing the first 72 bytes.
+func verifyBcrypt(password, encoded string) (bool, error) {
+	if len(password) > BcryptMaxBytes {
+		return false, nil
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == nil {
+		return true, nil
+	}
+
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+
+	return false, ErrInvalidHash
+}
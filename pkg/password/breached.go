@@ -0,0 +1,119 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const hashPrefixLength = 5
+
+// BreachedList checks passwords against a local copy of a breach corpus such as Have I Been Pwned's
+// Pwned Passwords, so no password or hash ever leaves the service. Passwords are looked up by their
+// SHA-1 hash split into a 5 character prefix and the remaining suffix, the k-anonymity layout of the
+// HIBP range API. Two sources are supported:
+//   - a directory of range files named after the prefix (00000.txt ... FFFFF.txt) with SUFFIX:COUNT
+//     lines, as written by the HIBP downloader, read on demand;
+//   - a single file with HASH:COUNT or HASH lines, loaded into memory, meant for curated lists.
+type BreachedList struct {
+	dir    string
+	hashes map[string]map[string]struct{} // prefix -> suffixes, only for single files
+}
+
+// LoadBreachedList opens the directory or loads the file at path.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &BreachedList{dir: path}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hashes := make(map[string]map[string]struct{})
+
+	err = scanHashes(file, func(hash string) error {
+		if len(hash) != sha1.Size*2 {
+			return fmt.Errorf("%s: invalid SHA-1 hash %q", path, hash)
+		}
+
+		prefix, suffix := hash[:hashPrefixLength], hash[hashPrefixLength:]
+		if hashes[prefix] == nil {
+			hashes[prefix] = make(map[string]struct{})
+		}
+		hashes[prefix][suffix] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BreachedList{hashes: hashes}, nil
+}
+
+// Contains reports whether the password appears in the list.
+func (b *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:hashPrefixLength], hash[hashPrefixLength:]
+
+	if b.hashes != nil {
+		_, ok := b.hashes[prefix][suffix]
+		return ok, nil
+	}
+
+	file, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	found := false
+	errFound := errors.New("found")
+
+	err = scanHashes(file, func(s string) error {
+		if s == suffix {
+			found = true
+			return errFound
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errFound) {
+		return false, err
+	}
+
+	return found, nil
+}
+
+// scanHashes calls fn with the upper-cased hash of every non-empty line, dropping the :COUNT part.
+func scanHashes(r io.Reader, fn func(hash string) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hash == "" {
+			continue
+		}
+
+		if err := fn(strings.ToUpper(hash)); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,26 @@
+// Package password hashes user passwords into self-describing strings: argon2id hashes use the PHC
+// string format and bcrypt hashes their modular crypt format, so every hash names its algorithm and
+// parameters and can be verified after the preferred algorithm changed.
+package password
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+	ErrInvalidHash       = errors.New("invalid password hash")
+)
+
+// Verify checks the password against a hash produced by any supported algorithm.
+func Verify(password, encoded string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, argon2idPrefix):
+		return verifyArgon2id(password, encoded)
+	case isBcrypt(encoded):
+		return verifyBcrypt(password, encoded)
+	default:
+		return false, ErrUnknownHashFormat
+	}
+}
@@ -0,0 +1,89 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2Params = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+func TestHashers(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher interface {
+			Hash(password string) (string, error)
+			Verify(password, encoded string) (bool, error)
+			NeedsRehash(encoded string) bool
+		}
+		prefix string
+	}{
+		{name: "bcrypt", hasher: NewBcrypt(bcrypt.MinCost), prefix: "$2a$04$"},
+		{name: "argon2id", hasher: NewArgon2id(testArgon2Params), prefix: "$argon2id$v=19$m=1024,t=1,p=1$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := tt.hasher.Hash("correct horse")
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(encoded, tt.prefix), encoded)
+			assert.False(t, tt.hasher.NeedsRehash(encoded))
+
+			ok, err := tt.hasher.Verify("correct horse", encoded)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			ok, err = tt.hasher.Verify("battery staple", encoded)
+			assert.NoError(t, err)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestVerifyAcrossAlgorithms(t *testing.T) {
+	legacy, err := NewBcrypt(bcrypt.MinCost).Hash("correct horse")
+	require.NoError(t, err)
+
+	argon := NewArgon2id(testArgon2Params)
+
+	ok, err := argon.Verify("correct horse", legacy)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, argon.NeedsRehash(legacy))
+
+	stronger := NewArgon2id(Argon2Params{Memory: 2048, Iterations: 1, Parallelism: 1})
+	encoded, err := argon.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, stronger.NeedsRehash(encoded))
+	assert.True(t, NewBcrypt(bcrypt.MinCost+1).NeedsRehash(legacy))
+
+	_, err = Verify("correct horse", "plaintext")
+	assert.ErrorIs(t, err, ErrUnknownHashFormat)
+
+	_, err = Verify("correct horse", "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5")
+	assert.ErrorIs(t, err, ErrInvalidHash)
+}
+
+func TestLongPasswords(t *testing.T) {
+	long := strings.Repeat("a", 72)
+
+	encoded, err := NewArgon2id(testArgon2Params).Hash(long + "b")
+	require.NoError(t, err)
+
+	ok, err := Verify(long+"c", encoded)
+	assert.NoError(t, err)
+	assert.False(t, ok, "argon2id must use the whole passphrase")
+
+	_, err = NewBcrypt(bcrypt.MinCost).Hash(long + "b")
+	assert.Error(t, err, "bcrypt must not truncate silently")
+
+	encoded, err = NewBcrypt(bcrypt.MinCost).Hash(long)
+	require.NoError(t, err)
+
+	ok, err = Verify(long+"b", encoded)
+	assert.NoError(t, err, "a too long password is a mismatch, not a broken hash")
+	assert.False(t, ok)
+}
@@ -0,0 +1,104 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy lists the rules a new password must follow. Zero values disable a rule.
+type Policy struct {
+	MinLength     int // characters, not bytes
+	MaxLength     int
+	MaxBytes      int // UTF-8 encoded length, the limit of the hash algorithm
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	DisallowEmail bool // neither the address nor its local part may appear in the password
+	Breached      *BreachedList
+}
+
+// Check returns the rules the password breaks, nil when it is acceptable. The error is only set when
+// the breached password list cannot be read.
+func (p *Policy) Check(password, email string) ([]string, error) {
+	var violations []string
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d characters long", p.MaxLength))
+	}
+
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes && (p.MaxLength == 0 || length <= p.MaxLength) {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes long", p.MaxBytes))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	if p.RequireUpper && !upper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+
+	if p.RequireLower && !lower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+
+	if p.RequireDigit && !digit {
+		violations = append(violations, "must contain a digit")
+	}
+
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	if p.DisallowEmail && containsEmail(password, email) {
+		violations = append(violations, "must not contain the email address")
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+
+		if breached {
+			violations = append(violations, "appears in a known data breach")
+		}
+	}
+
+	return violations, nil
+}
+
+// containsEmail ignores local parts shorter than three characters, which would match too many passwords.
+func containsEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+
+	password = strings.ToLower(password)
+	email = strings.ToLower(email)
+
+	if strings.Contains(password, email) {
+		return true
+	}
+
+	local, _, _ := strings.Cut(email, "@")
+	return len(local) >= 3 && strings.Contains(password, local)
+}
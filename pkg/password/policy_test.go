@@ -0,0 +1,118 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestPolicy_Check(t *testing.T) {
+	policy := &Policy{
+		MinLength:     10,
+		MaxLength:     20,
+		MaxBytes:      32,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		DisallowEmail: true,
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{
+			name:     "valid password",
+			password: "Tr0ub4dor&3xyz",
+		},
+		{
+			name:     "too short and missing classes",
+			password: "abc",
+			want: []string{
+				"must be at least 10 characters long",
+				"must contain an uppercase letter",
+				"must contain a digit",
+				"must contain a symbol",
+			},
+		},
+		{
+			name:     "too long",
+			password: "Tr0ub4dor&3xyzTr0ub4dor&3xyz",
+			want:     []string{"must be at most 20 characters long"},
+		},
+		{
+			name:     "length counts characters",
+			password: "Пароль-123ы",
+		},
+		{
+			name:     "too many bytes",
+			password: "Пароль-123ыПарольыы",
+			want:     []string{"must be at most 32 bytes long"},
+		},
+		{
+			name:     "contains email local part",
+			password: "Alice.Smith#2024",
+			want:     []string{"must not contain the email address"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.Check(tt.password, "alice.smith@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBreachedList(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "breached.txt")
+	require.NoError(t, os.WriteFile(file, []byte(sha1Hex("password123")+":123\n\n"+strings.ToLower(sha1Hex("qwerty"))+"\n"), 0o600))
+
+	ranges := filepath.Join(dir, "ranges")
+	require.NoError(t, os.Mkdir(ranges, 0o755))
+	hash := sha1Hex("password123")
+	require.NoError(t, os.WriteFile(filepath.Join(ranges, hash[:5]+".txt"), []byte("0000000000000000000000000000000000A:1\r\n"+hash[5:]+":42\r\n"), 0o600))
+
+	for _, path := range []string{file, ranges} {
+		list, err := LoadBreachedList(path)
+		require.NoError(t, err)
+
+		breached, err := list.Contains("password123")
+		assert.NoError(t, err)
+		assert.True(t, breached, path)
+
+		breached, err = list.Contains("correct horse battery staple")
+		assert.NoError(t, err)
+		assert.False(t, breached, path)
+	}
+
+	list, err := LoadBreachedList(file)
+	require.NoError(t, err)
+	breached, err := list.Contains("qwerty")
+	assert.NoError(t, err)
+	assert.True(t, breached)
+
+	violations, err := (&Policy{Breached: list}).Check("qwerty", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"appears in a known data breach"}, violations)
+
+	require.NoError(t, os.WriteFile(file, []byte("not-a-hash\n"), 0o600))
+	_, err = LoadBreachedList(file)
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA1 key from the test vectors in RFC 6238, appendix B.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "time %d", tt.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	code, err := Code(secret, now)
+	require.NoError(t, err)
+
+	step, ok := Validate(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	_, ok = Validate(secret, code, now.Add(Period))
+	assert.True(t, ok, "previous step is accepted for clock skew")
+
+	_, ok = Validate(secret, code, now.Add(3*Period))
+	assert.False(t, ok)
+
+	_, ok = Validate(secret, "12345", now)
+	assert.False(t, ok)
+
+	_, ok = Validate("not base32!", code, now)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("JBSWY3DPEHPK3PXP", "jwt-example", "test@example.com"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/jwt-example:test@example.com", uri.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	assert.Equal(t, "jwt-example", uri.Query().Get("issuer"))
+}
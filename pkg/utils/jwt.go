@@ -1,8 +1,13 @@
 package utils
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -12,15 +17,116 @@ import (
 	"github.com/sanchey92/jwt-example/internal/models"
 )
 
-func GenerateJWTToken(user *models.User, ttl int, secret string) (string, error) {
-	claims := jwt.MapClaims{
-		"sub":  user.ID.String(),
-		"role": user.Role,
-		"exp":  time.Now().Add(time.Duration(ttl) * time.Minute).Unix(),
+// Claims are the access token claims. Every token gets a unique ID (jti); SessionID (sid) names
+// the refresh token family the token was issued for and TokenVersion (ver) the version of the user's
+// tokens, bumped to revoke all of them at once. Roles and Permissions are a snapshot taken at
+// issuance, so requests can be authorized without loading them again. Tokens issued to an OAuth
+// client carry its ClientID and the granted Scope (space-separated, RFC 9068) instead. The subject
+// of a client_credentials token is the client itself.
+type Claims struct {
+	// Deprecated: Role is the single role claim of earlier releases, kept for one release so
+	// consumers can move to Roles. It holds RoleAdmin when the user has it, the first role otherwise.
+	Role         models.Role         `json:"role,omitempty"`
+	Roles        []models.Role       `json:"roles,omitempty"`
+	Permissions  []models.Permission `json:"permissions,omitempty"`
+	SessionID    string              `json:"sid,omitempty"`
+	TokenVersion int64               `json:"ver,omitempty"`
+	ClientID     string              `json:"client_id,omitempty"`
+	Scope        string              `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IsClient reports whether the token was issued to an OAuth client acting for itself.
+func (c *Claims) IsClient() bool {
+	return c.ClientID != "" && c.Subject == c.ClientID
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Claims) HasRole(role models.Role) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Claims) HasPermission(permission models.Permission) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token (OIDC Core section 2). The audience
+// is the client the token was issued to.
+type IDTokenClaims struct {
+	Nonce         string           `json:"nonce,omitempty"`
+	AuthTime      *jwt.NumericDate `json:"auth_time,omitempty"`
+	Email         string           `json:"email,omitempty"`
+	EmailVerified *bool            `json:"email_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenOptions bind tokens to one deployment: tokens are issued with Issuer and Audience,
+// and parsing rejects tokens minted for another issuer or audience. Leeway absorbs clock skew.
+type TokenOptions struct {
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+func GenerateJWTToken(user *models.User, ttl int, signer Signer, opts TokenOptions) (string, error) {
+	return signer.Sign(NewClaims(user, ttl, opts))
+}
+
+// NewClaims builds access token claims for the user, valid for ttl minutes.
+func NewClaims(user *models.User, ttl int, opts TokenOptions) *Claims {
+	return &Claims{
+		Role:             models.LegacyRole(user.Roles),
+		Roles:            user.Roles,
+		TokenVersion:     user.TokenVersion,
+		Permissions:      user.Permissions,
+		RegisteredClaims: newRegisteredClaims(user.ID.String(), ttl, opts),
 	}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+// NewClientClaims builds access token claims for an OAuth client acting for itself, valid for ttl minutes.
+func NewClientClaims(clientID, scope string, ttl int, opts TokenOptions) *Claims {
+	return &Claims{
+		ClientID:         clientID,
+		Scope:            scope,
+		RegisteredClaims: newRegisteredClaims(clientID, ttl, opts),
+	}
+}
+
+func newRegisteredClaims(subject string, ttl int, opts TokenOptions) jwt.RegisteredClaims {
+	now := time.Now()
+
+	claims := jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		Subject:   subject,
+		Issuer:    opts.Issuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(ttl) * time.Minute)),
+	}
+
+	if opts.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{opts.Audience}
+	}
+
+	return claims
 }
 
 func GenerateRefreshToken(length int) (string, error) {
@@ -38,39 +144,59 @@ func GenerateRefreshToken(length int) (string, error) {
 	return tokenString, nil
 }
 
-func ParseToken(tokenString string, secret string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, appError.ErrInvalidToken
-		}
-		return []byte(secret), nil
-	})
+// HashToken returns the keyed hash under which opaque tokens (refresh, password reset) are stored,
+// so a database dump does not contain usable tokens.
+func HashToken(token, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func ParseToken(tokenString string, verifier Verifier, opts TokenOptions) (*Claims, error) {
+	parserOpts := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(opts.Leeway),
+	}
+
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+
+	claims := &Claims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, verifier.VerificationKey, parserOpts...)
 	if err != nil {
+		// The signature is checked before the claims, so an expired token is still authentic.
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, appError.ErrTokenExpired
+		}
 		return nil, err
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
+	if !token.Valid {
 		return nil, appError.ErrInvalidToken
 	}
 
 	return claims, nil
 }
 
-func ExtractUserID(claims jwt.MapClaims) (uuid.UUID, error) {
-	userIDStr, ok := claims["sub"].(string)
-	if !ok {
+func ExtractUserID(claims *Claims) (uuid.UUID, error) {
+	if claims.Subject == "" {
 		return uuid.Nil, appError.ErrInvalidToken
 	}
 
-	return uuid.Parse(userIDStr)
+	return uuid.Parse(claims.Subject)
 }
 
-func IsTokenExpired(claims jwt.MapClaims) bool {
-	exp, ok := claims["exp"].(float64)
-	if !ok {
+func IsTokenExpired(claims *Claims) bool {
+	if claims.ExpiresAt == nil {
 		return true
 	}
 
-	return time.Now().Unix() > int64(exp)
+	return time.Now().After(claims.ExpiresAt.Time)
 }
@@ -17,6 +17,8 @@ var (
 	testSecret = "testSecret"
 	testTTL    = 5
 	testUUID   = uuid.New() // minutes
+
+	testOptions = TokenOptions{Issuer: "test-issuer", Audience: "test-audience"}
 )
 
 func TestGenerateJWTToken(t *testing.T) {
@@ -30,8 +32,8 @@ func TestGenerateJWTToken(t *testing.T) {
 		{
 			name: "valid token generation",
 			user: &models.User{
-				ID:   uuid.New(),
-				Role: models.RoleUser,
+				ID:    uuid.New(),
+				Roles: []models.Role{models.RoleUser},
 			},
 			secret:  testSecret,
 			ttl:     testTTL,
@@ -40,8 +42,8 @@ func TestGenerateJWTToken(t *testing.T) {
 		{
 			name: "expired token",
 			user: &models.User{
-				ID:   uuid.New(),
-				Role: models.RoleUser,
+				ID:    uuid.New(),
+				Roles: []models.Role{models.RoleUser},
 			},
 			ttl:     -1, // Token already expired
 			secret:  testSecret,
@@ -51,7 +53,7 @@ func TestGenerateJWTToken(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tokenStr, err := GenerateJWTToken(tt.user, tt.ttl, tt.secret)
+			tokenStr, err := GenerateJWTToken(tt.user, tt.ttl, NewHMACKey(tt.secret), testOptions)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -78,7 +80,8 @@ func TestGenerateJWTToken(t *testing.T) {
 			claims, ok := token.Claims.(jwt.MapClaims)
 			assert.True(t, ok)
 			assert.Equal(t, tt.user.ID.String(), claims["sub"])
-			assert.Equal(t, string(tt.user.Role), claims["role"])
+			assert.Equal(t, []interface{}{string(models.RoleUser)}, claims["roles"])
+			assert.Equal(t, string(models.RoleUser), claims["role"])
 
 			exp, ok := claims["exp"].(float64)
 			assert.True(t, ok)
@@ -92,6 +95,25 @@ func TestGenerateJWTToken(t *testing.T) {
 	}
 }
 
+func TestNewClaims_LegacyRole(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles []models.Role
+		want  models.Role
+	}{
+		{name: "no roles", want: ""},
+		{name: "admin wins", roles: []models.Role{"auditor", models.RoleAdmin, models.RoleUser}, want: models.RoleAdmin},
+		{name: "first role", roles: []models.Role{"auditor", models.RoleUser}, want: "auditor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := NewClaims(&models.User{ID: uuid.New(), Roles: tt.roles}, testTTL, testOptions)
+			assert.Equal(t, tt.want, claims.Role)
+		})
+	}
+}
+
 func TestGenerateRefreshToken(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -168,8 +190,8 @@ func TestParseToken(t *testing.T) {
 		{
 			name: "success case",
 			user: &models.User{
-				ID:   uuid.New(),
-				Role: models.RoleUser,
+				ID:    uuid.New(),
+				Roles: []models.Role{models.RoleUser},
 			},
 			secret:  testSecret,
 			ttl:     testTTL,
@@ -179,12 +201,12 @@ func TestParseToken(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			token, err := GenerateJWTToken(tt.user, tt.ttl, tt.secret)
+			token, err := GenerateJWTToken(tt.user, tt.ttl, NewHMACKey(tt.secret), testOptions)
 
 			assert.NoError(t, err)
 			assert.NotEmpty(t, token)
 
-			claims, err := ParseToken(token, tt.secret)
+			claims, err := ParseToken(token, NewHMACKey(tt.secret), testOptions)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -193,10 +215,10 @@ func TestParseToken(t *testing.T) {
 			assert.NoError(t, err)
 			assert.NotEmpty(t, claims)
 
-			role, ok := claims["role"].(string)
-
-			assert.True(t, ok)
-			assert.Equal(t, string(tt.user.Role), role)
+			assert.Equal(t, tt.user.Roles, claims.Roles)
+			assert.Equal(t, testOptions.Issuer, claims.Issuer)
+			assert.Equal(t, jwt.ClaimStrings{testOptions.Audience}, claims.Audience)
+			assert.NotEmpty(t, claims.ID)
 		})
 	}
 }
@@ -213,8 +235,8 @@ func Test_extractUserID(t *testing.T) {
 		{
 			name: "success case",
 			user: &models.User{
-				ID:   testUUID,
-				Role: models.RoleUser,
+				ID:    testUUID,
+				Roles: []models.Role{models.RoleUser},
 			},
 			uuid:    testUUID,
 			secret:  testSecret,
@@ -224,8 +246,8 @@ func Test_extractUserID(t *testing.T) {
 		{
 			name: "failure case",
 			user: &models.User{
-				ID:   uuid.Nil, // Или можно оставить валидный, но подменить claims позже
-				Role: models.RoleUser,
+				ID:    uuid.Nil, // Или можно оставить валидный, но подменить claims позже
+				Roles: []models.Role{models.RoleUser},
 			},
 			uuid:    testUUID, // Ожидаемое значение, но оно не должно совпасть
 			secret:  testSecret,
@@ -236,16 +258,16 @@ func Test_extractUserID(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			token, err := GenerateJWTToken(tt.user, tt.ttl, tt.secret)
+			token, err := GenerateJWTToken(tt.user, tt.ttl, NewHMACKey(tt.secret), testOptions)
 			assert.NoError(t, err)
 			assert.NotEmpty(t, token)
 
-			claims, err := ParseToken(token, tt.secret)
+			claims, err := ParseToken(token, NewHMACKey(tt.secret), testOptions)
 			assert.NoError(t, err)
 			assert.NotEmpty(t, claims)
 
 			if tt.wantErr {
-				claims["sub"] = "invalid-uuid"
+				claims.Subject = "invalid-uuid"
 				userID, err := ExtractUserID(claims)
 				assert.Error(t, err)
 				assert.Empty(t, userID)
@@ -258,3 +280,91 @@ func Test_extractUserID(t *testing.T) {
 		})
 	}
 }
+
+func TestParseToken_RegisteredClaims(t *testing.T) {
+	key := NewHMACKey(testSecret)
+	user := &models.User{
+		ID:          uuid.New(),
+		Roles:       []models.Role{models.RoleAdmin},
+		Permissions: []models.Permission{models.PermissionUsersRead},
+	}
+
+	tests := []struct {
+		name    string
+		issued  TokenOptions
+		ttl     int
+		wantErr error
+	}{
+		{
+			name:   "matching issuer and audience",
+			issued: testOptions,
+			ttl:    testTTL,
+		},
+		{
+			name:   "other environment issuer",
+			issued: TokenOptions{Issuer: "staging", Audience: testOptions.Audience},
+			ttl:    testTTL,
+		},
+		{
+			name:   "other audience",
+			issued: TokenOptions{Issuer: testOptions.Issuer, Audience: "billing"},
+			ttl:    testTTL,
+		},
+		{
+			name:    "expired token",
+			issued:  testOptions,
+			ttl:     -1,
+			wantErr: appError.ErrTokenExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := GenerateJWTToken(user, tt.ttl, key, tt.issued)
+			assert.NoError(t, err)
+
+			claims, err := ParseToken(token, key, testOptions)
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.issued != testOptions:
+				assert.Error(t, err)
+			default:
+				assert.NoError(t, err)
+				assert.Equal(t, user.Roles, claims.Roles)
+				assert.Equal(t, user.Permissions, claims.Permissions)
+				assert.False(t, IsTokenExpired(claims))
+			}
+		})
+	}
+}
+
+func TestParseToken_Leeway(t *testing.T) {
+	key := NewHMACKey(testSecret)
+
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(10 * time.Second)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+	token, err := key.Sign(claims)
+	assert.NoError(t, err)
+
+	_, err = ParseToken(token, key, TokenOptions{})
+	assert.Error(t, err, "token issued in the future")
+
+	_, err = ParseToken(token, key, TokenOptions{Leeway: 30 * time.Second})
+	assert.NoError(t, err)
+}
+
+func TestHashToken(t *testing.T) {
+	hash := HashToken("token", testSecret)
+
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, HashToken("token", testSecret))
+	assert.NotEqual(t, hash, HashToken("token", "otherSecret"))
+	assert.NotEqual(t, hash, HashToken("other", testSecret))
+}
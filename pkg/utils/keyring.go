@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/pkg/jwk"
+)
+
+// KeyRing signs with its active key and verifies with any key that has not been retired yet,
+// so rotating the signing key does not invalidate tokens that are already issued.
+type KeyRing struct {
+	mu     sync.RWMutex
+	active *ringKey
+	base   *Key // the configured key, active until the first scheduled key takes over
+	keys   []*ringKey
+}
+
+type ringKey struct {
+	key       *Key
+	retiredAt time.Time // zero while the key is active or scheduled
+	scheduled bool      // placed by Schedule, replaced on the next call
+}
+
+func (k *ringKey) retired(now time.Time) bool {
+	return !k.retiredAt.IsZero() && !now.Before(k.retiredAt)
+}
+
+func NewKeyRing(active *Key) *KeyRing {
+	k := &ringKey{key: active}
+	return &KeyRing{
+		active: k,
+		base:   active,
+		keys:   []*ringKey{k},
+	}
+}
+
+// AddRetiring registers a key that is accepted for verification only until retiredAt.
+func (r *KeyRing) AddRetiring(key *Key, retiredAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.keys = append(r.keys, &ringKey{key: key, retiredAt: retiredAt})
+}
+
+// ScheduledKey is a signing key that takes over at ActivatesAt.
+type ScheduledKey struct {
+	Key         *Key
+	ActivatesAt time.Time
+}
+
+// Schedule rebuilds the ring from the key it was created with followed by the scheduled keys. The
+// last key activated by now signs, the ones before it keep verifying tokens until grace after
+// their successor activated. Keys not activated yet already verify, so instances whose clock is
+// ahead can use them and consumers of the JWKS learn about them before they sign anything.
+func (r *KeyRing) Schedule(scheduled []ScheduledKey, grace time.Duration, now time.Time) {
+	entries := append([]ScheduledKey{{Key: r.base}}, scheduled...)
+	slices.SortStableFunc(entries[1:], func(a, b ScheduledKey) int {
+		return a.ActivatesAt.Compare(b.ActivatesAt)
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var keys []*ringKey
+	for _, k := range r.keys {
+		if !k.scheduled && k.key != r.base && !k.retired(now) {
+			keys = append(keys, k)
+		}
+	}
+
+	var active *ringKey
+	for i, entry := range entries {
+		k := &ringKey{key: entry.Key, scheduled: true}
+
+		if !entry.ActivatesAt.After(now) {
+			if i+1 < len(entries) && !entries[i+1].ActivatesAt.After(now) {
+				k.retiredAt = entries[i+1].ActivatesAt.Add(grace)
+			} else {
+				active = k
+			}
+		}
+
+		if !k.retired(now) {
+			keys = append(keys, k)
+		}
+	}
+
+	r.active = active
+	r.keys = keys
+}
+
+func (r *KeyRing) Algorithm() string {
+	return r.activeKey().Algorithm()
+}
+
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	return r.activeKey().Sign(claims)
+}
+
+// VerificationKey picks the key named by the token kid header. Tokens without kid were issued
+// before key ids were introduced and are checked against the active key.
+func (r *KeyRing) VerificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return r.activeKey().VerificationKey(token)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	for _, k := range r.keys {
+		if k.key.KeyID() != kid {
+			continue
+		}
+		if k.retired(now) {
+			return nil, appError.ErrInvalidToken
+		}
+		return k.key.VerificationKey(token)
+	}
+
+	return nil, appError.ErrUnknownKeyID
+}
+
+// JWKS lists the public keys that still verify tokens. HMAC keys are never published.
+func (r *KeyRing) JWKS() (jwk.Set, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := jwk.Set{Keys: []jwk.Key{}}
+	now := time.Now()
+
+	for _, k := range r.keys {
+		if k.retired(now) {
+			continue
+		}
+
+		publicKey := k.key.PublicKey()
+		if publicKey == nil {
+			continue
+		}
+
+		key, err := jwk.New(k.key.KeyID(), k.key.Algorithm(), publicKey)
+		if err != nil {
+			return jwk.Set{}, err
+		}
+		set.Keys = append(set.Keys, key)
+	}
+
+	return set, nil
+}
+
+func (r *KeyRing) activeKey() *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.active.key
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+)
+
+func TestKeyRing_Schedule(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Roles: []models.Role{models.RoleUser}}
+
+	first, err := GenerateKey(AlgEdDSA)
+	require.NoError(t, err)
+	second, err := GenerateKey(AlgEdDSA)
+	require.NoError(t, err)
+
+	ring := NewKeyRing(first)
+	now := time.Now()
+	scheduled := []ScheduledKey{{Key: second, ActivatesAt: now.Add(time.Minute)}}
+
+	ring.Schedule(scheduled, time.Hour, now)
+
+	oldToken, err := GenerateJWTToken(user, testTTL, ring, testOptions)
+	require.NoError(t, err)
+	assert.Equal(t, first.KeyID(), tokenKeyID(t, oldToken), "scheduled key must not sign before it activates")
+
+	set, err := ring.JWKS()
+	require.NoError(t, err)
+	assert.Len(t, set.Keys, 2, "scheduled key must be published before it activates")
+
+	ring.Schedule(scheduled, time.Hour, now.Add(2*time.Minute))
+
+	newToken, err := GenerateJWTToken(user, testTTL, ring, testOptions)
+	require.NoError(t, err)
+	assert.Equal(t, second.KeyID(), tokenKeyID(t, newToken))
+
+	_, err = ParseToken(oldToken, ring, testOptions)
+	assert.NoError(t, err, "replaced key must verify during the grace period")
+
+	ring.Schedule(scheduled, time.Hour, now.Add(2*time.Hour))
+
+	_, err = ParseToken(oldToken, ring, testOptions)
+	assert.ErrorIs(t, err, appError.ErrUnknownKeyID)
+	_, err = ParseToken(newToken, ring, testOptions)
+	assert.NoError(t, err)
+}
+
+func TestKeyRing_RetiredKey(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Roles: []models.Role{models.RoleUser}}
+	previous := NewHMACKey("previous")
+
+	token, err := GenerateJWTToken(user, testTTL, previous, testOptions)
+	require.NoError(t, err)
+
+	ring := NewKeyRing(NewHMACKey(testSecret))
+
+	ring.AddRetiring(previous, time.Now().Add(time.Minute))
+	_, err = ParseToken(token, ring, testOptions)
+	assert.NoError(t, err)
+
+	retired := NewKeyRing(NewHMACKey(testSecret))
+	retired.AddRetiring(previous, time.Now().Add(-time.Minute))
+	_, err = ParseToken(token, retired, testOptions)
+	assert.Error(t, err)
+}
+
+func TestKeyRing_TokenWithoutKeyID(t *testing.T) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": uuid.New().String(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	tokenStr, err := token.SignedString([]byte(testSecret))
+	require.NoError(t, err)
+
+	_, err = ParseToken(tokenStr, NewKeyRing(NewHMACKey(testSecret)), TokenOptions{})
+	assert.NoError(t, err)
+}
+
+func tokenKeyID(t *testing.T, tokenStr string) string {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenStr, jwt.MapClaims{})
+	require.NoError(t, err)
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+func TestKeyRing_JWKS(t *testing.T) {
+	active, err := GenerateKey(AlgES256)
+	require.NoError(t, err)
+	retired, err := GenerateKey(AlgES256)
+	require.NoError(t, err)
+
+	ring := NewKeyRing(active)
+	ring.AddRetiring(retired, time.Now().Add(-time.Second))
+
+	set, err := ring.JWKS()
+	require.NoError(t, err)
+	require.Len(t, set.Keys, 1)
+	assert.Equal(t, active.KeyID(), set.Keys[0].Kid)
+	assert.Equal(t, AlgES256, set.Keys[0].Alg)
+
+	set, err = NewKeyRing(NewHMACKey(testSecret)).JWKS()
+	require.NoError(t, err)
+	assert.Empty(t, set.Keys)
+}
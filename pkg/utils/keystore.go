@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"time"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+)
+
+// KeyStore keeps the signing keys created by scheduled rotation where every instance finds them.
+type KeyStore interface {
+	ListSigningKeys(ctx context.Context) ([]models.SigningKey, error)
+	SaveSigningKey(ctx context.Context, key *models.SigningKey) error
+	// DeleteRetiredSigningKeys drops the keys whose successor activated before the given time.
+	DeleteRetiredSigningKeys(ctx context.Context, before time.Time) error
+}
+
+// KeyRotation rotates the signing key of a ring through a store shared by all instances, so tokens
+// signed by one instance verify on the others and keep verifying after a restart.
+type KeyRotation struct {
+	Ring      *KeyRing
+	Store     KeyStore
+	Algorithm string
+	Secret    string        // seals the private keys in the store
+	Interval  time.Duration // age of the active key after which the next one is scheduled
+	Delay     time.Duration // from scheduling a key until it signs
+	Grace     time.Duration // a replaced key keeps verifying tokens this long
+}
+
+// Sync loads the stored keys into the ring, scheduling a new key first when the latest one is due
+// for rotation. Every instance has to sync more often than Delay, so each of them knows a key
+// before any of them signs with it.
+func (k *KeyRotation) Sync(ctx context.Context, now time.Time) error {
+	stored, err := k.Store.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	scheduled := make([]ScheduledKey, 0, len(stored)+1)
+	var latest *models.SigningKey
+
+	for i := range stored {
+		key, err := OpenKey(stored[i].Algorithm, stored[i].SealedKey, k.Secret)
+		if err != nil {
+			return err
+		}
+
+		if key.KeyID() != stored[i].KeyID {
+			return appError.ErrInvalidSigningKey
+		}
+
+		scheduled = append(scheduled, ScheduledKey{Key: key, ActivatesAt: stored[i].ActivatesAt})
+		if latest == nil || stored[i].ActivatesAt.After(latest.ActivatesAt) {
+			latest = &stored[i]
+		}
+	}
+
+	if latest == nil || latest.Algorithm != k.Algorithm || !now.Before(latest.ActivatesAt.Add(k.Interval)) {
+		next, err := k.scheduleKey(ctx, now)
+		if err != nil {
+			return err
+		}
+		scheduled = append(scheduled, next)
+	}
+
+	k.Ring.Schedule(scheduled, k.Grace, now)
+
+	return k.Store.DeleteRetiredSigningKeys(ctx, now.Add(-k.Grace))
+}
+
+func (k *KeyRotation) scheduleKey(ctx context.Context, now time.Time) (ScheduledKey, error) {
+	key, err := GenerateKey(k.Algorithm)
+	if err != nil {
+		return ScheduledKey{}, err
+	}
+
+	sealed, err := SealKey(key, k.Secret)
+	if err != nil {
+		return ScheduledKey{}, err
+	}
+
+	stored := &models.SigningKey{
+		KeyID:       key.KeyID(),
+		Algorithm:   key.Algorithm(),
+		SealedKey:   sealed,
+		ActivatesAt: now.Add(k.Delay),
+		CreatedAt:   now,
+	}
+
+	if err = k.Store.SaveSigningKey(ctx, stored); err != nil {
+		return ScheduledKey{}, err
+	}
+
+	return ScheduledKey{Key: key, ActivatesAt: stored.ActivatesAt}, nil
+}
+
+// SealKey encrypts the private half of the key with AES-GCM under a key derived from secret.
+func SealKey(key *Key, secret string) ([]byte, error) {
+	var (
+		plaintext []byte
+		err       error
+	)
+
+	switch signingKey := key.signingKey.(type) {
+	case nil:
+		return nil, appError.ErrMissingSigningKey
+	case []byte:
+		plaintext = signingKey
+	default:
+		if plaintext, err = x509.MarshalPKCS8PrivateKey(signingKey); err != nil {
+			return nil, appError.ErrInvalidSigningKey
+		}
+	}
+
+	aead, err := keySealer(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, appError.ErrFailedRandGeneration
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, []byte(key.Algorithm())), nil
+}
+
+// OpenKey decrypts a key sealed by SealKey.
+func OpenKey(alg string, sealed []byte, secret string) (*Key, error) {
+	aead, err := keySealer(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, appError.ErrInvalidSigningKey
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(alg))
+	if err != nil {
+		return nil, appError.ErrInvalidSigningKey
+	}
+
+	if alg == AlgHS256 {
+		return NewHMACKey(string(plaintext)), nil
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(plaintext)
+	if err != nil {
+		return nil, appError.ErrInvalidSigningKey
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, appError.ErrInvalidSigningKey
+	}
+
+	return NewKey(alg, signer)
+}
+
+func keySealer(secret string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("signing-key"))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sanchey92/jwt-example/internal/models"
+)
+
+type memoryKeyStore struct {
+	keys []models.SigningKey
+}
+
+func (s *memoryKeyStore) ListSigningKeys(context.Context) ([]models.SigningKey, error) {
+	return append([]models.SigningKey(nil), s.keys...), nil
+}
+
+func (s *memoryKeyStore) SaveSigningKey(_ context.Context, key *models.SigningKey) error {
+	s.keys = append(s.keys, *key)
+	return nil
+}
+
+func (s *memoryKeyStore) DeleteRetiredSigningKeys(_ context.Context, before time.Time) error {
+	keys := s.keys[:0]
+	for _, k := range s.keys {
+		retired := false
+		for _, n := range s.keys {
+			if n.ActivatesAt.After(k.ActivatesAt) && n.ActivatesAt.Before(before) {
+				retired = true
+			}
+		}
+		if !retired {
+			keys = append(keys, k)
+		}
+	}
+	s.keys = keys
+	return nil
+}
+
+func TestKeyRotation_Sync(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Roles: []models.Role{models.RoleUser}}
+	store := &memoryKeyStore{}
+
+	newRotation := func() *KeyRotation {
+		return &KeyRotation{
+			Ring:      NewKeyRing(NewHMACKey(testSecret)),
+			Store:     store,
+			Algorithm: AlgES256,
+			Secret:    "seal-secret",
+			Interval:  time.Hour,
+			Delay:     5 * time.Minute,
+			Grace:     30 * time.Minute,
+		}
+	}
+
+	now := time.Now()
+	first, second := newRotation(), newRotation()
+
+	require.NoError(t, first.Sync(context.Background(), now))
+	require.NoError(t, second.Sync(context.Background(), now.Add(time.Minute)))
+	require.Len(t, store.keys, 1, "instances must share the scheduled key")
+
+	require.NoError(t, first.Sync(context.Background(), now.Add(6*time.Minute)))
+	require.NoError(t, second.Sync(context.Background(), now.Add(6*time.Minute)))
+
+	token, err := GenerateJWTToken(user, testTTL, first.Ring, testOptions)
+	require.NoError(t, err)
+	assert.Equal(t, store.keys[0].KeyID, tokenKeyID(t, token))
+
+	_, err = ParseToken(token, second.Ring, testOptions)
+	assert.NoError(t, err, "a token signed by one instance must verify on the others")
+
+	restarted := newRotation()
+	require.NoError(t, restarted.Sync(context.Background(), now.Add(7*time.Minute)))
+	_, err = ParseToken(token, restarted.Ring, testOptions)
+	assert.NoError(t, err, "a restart must keep the rotated keys")
+
+	require.NoError(t, first.Sync(context.Background(), now.Add(66*time.Minute)))
+	assert.Len(t, store.keys, 2, "the due key is scheduled once")
+
+	require.NoError(t, first.Sync(context.Background(), now.Add(2*time.Hour)))
+	assert.Len(t, store.keys, 1, "retired keys are deleted")
+}
+
+func TestSealKey(t *testing.T) {
+	for _, alg := range []string{AlgHS256, AlgRS256, AlgES256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := GenerateKey(alg)
+			require.NoError(t, err)
+
+			sealed, err := SealKey(key, "seal-secret")
+			require.NoError(t, err)
+
+			opened, err := OpenKey(alg, sealed, "seal-secret")
+			require.NoError(t, err)
+			assert.Equal(t, key.KeyID(), opened.KeyID())
+
+			_, err = OpenKey(alg, sealed, "other-secret")
+			assert.Error(t, err)
+		})
+	}
+}
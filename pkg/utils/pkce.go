@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+// IsPKCEValue reports whether s is a valid PKCE code verifier (RFC 7636 section 4.1): 43 to 128
+// characters from the unreserved set. S256 challenges are always 43 characters of the same set.
+func IsPKCEValue(s string) bool {
+	if len(s) < 43 || len(s) > 128 {
+		return false
+	}
+
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// PKCEChallenge returns the S256 code challenge of the verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE checks the verifier against an S256 code challenge.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !IsPKCEValue(verifier) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
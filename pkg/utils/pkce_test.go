@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// Example from RFC 7636 appendix B.
+	const (
+		verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{name: "rfc example", verifier: verifier, challenge: challenge, want: true},
+		{name: "wrong verifier", verifier: strings.Repeat("a", 43), challenge: challenge, want: false},
+		{name: "verifier too short", verifier: verifier[:42], challenge: PKCEChallenge(verifier[:42]), want: false},
+		{name: "invalid character", verifier: verifier[:42] + "+", challenge: PKCEChallenge(verifier[:42] + "+"), want: false},
+		{name: "plain challenge", verifier: verifier, challenge: verifier, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, VerifyPKCE(tt.verifier, tt.challenge))
+		})
+	}
+
+	assert.Equal(t, challenge, PKCEChallenge(verifier))
+}
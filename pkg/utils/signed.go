@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+)
+
+var signedTokenEncoding = base64.URLEncoding.WithPadding(base64.NoPadding)
+
+// SignToken returns a compact "payload.signature" token carrying the subject and its expiry. Unlike
+// refresh tokens it is checked by signature alone, so it needs no storage, but it cannot be revoked
+// before it expires.
+func SignToken(subject string, expiresAt time.Time, secret string) string {
+	payload := signedTokenEncoding.EncodeToString([]byte(strconv.FormatInt(expiresAt.Unix(), 10) + "|" + subject))
+	return payload + "." + signedTokenEncoding.EncodeToString(signPayload(payload, secret))
+}
+
+// VerifySignedToken checks a token created by SignToken and returns its subject.
+func VerifySignedToken(token, secret string) (string, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", appError.ErrInvalidToken
+	}
+
+	mac, err := signedTokenEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, signPayload(payload, secret)) {
+		return "", appError.ErrInvalidToken
+	}
+
+	data, err := signedTokenEncoding.DecodeString(payload)
+	if err != nil {
+		return "", appError.ErrInvalidToken
+	}
+
+	expiry, subject, ok := strings.Cut(string(data), "|")
+	if !ok {
+		return "", appError.ErrInvalidToken
+	}
+
+	exp, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", appError.ErrInvalidToken
+	}
+
+	if time.Now().After(time.Unix(exp, 0)) {
+		return "", appError.ErrTokenExpired
+	}
+
+	return subject, nil
+}
+
+func signPayload(payload, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+)
+
+func TestSignedToken(t *testing.T) {
+	const subject = "email-verification|42|test@example.com"
+
+	valid := SignToken(subject, time.Now().Add(time.Hour), testSecret)
+	other := SignToken("email-verification|43|test@example.com", time.Now().Add(time.Hour), testSecret)
+	_, signature, _ := strings.Cut(valid, ".")
+	payload, _, _ := strings.Cut(other, ".")
+
+	tests := []struct {
+		name    string
+		token   string
+		secret  string
+		wantErr error
+	}{
+		{
+			name:   "valid token",
+			token:  valid,
+			secret: testSecret,
+		},
+		{
+			name:    "expired token",
+			token:   SignToken(subject, time.Now().Add(-time.Minute), testSecret),
+			secret:  testSecret,
+			wantErr: appError.ErrTokenExpired,
+		},
+		{
+			name:    "other secret",
+			token:   valid,
+			secret:  "other-secret",
+			wantErr: appError.ErrInvalidToken,
+		},
+		{
+			name:    "tampered payload",
+			token:   payload + "." + signature,
+			secret:  testSecret,
+			wantErr: appError.ErrInvalidToken,
+		},
+		{
+			name:    "malformed token",
+			token:   strings.ReplaceAll(valid, ".", ""),
+			secret:  testSecret,
+			wantErr: appError.ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifySignedToken(tt.token, tt.secret)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, subject, got)
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Signer signs token claims with its current key.
+type Signer interface {
+	Sign(claims jwt.Claims) (string, error)
+}
+
+// Verifier resolves the key that must be used to check the signature of a parsed token.
+type Verifier interface {
+	VerificationKey(token *jwt.Token) (interface{}, error)
+}
+
+type KeySet interface {
+	Signer
+	Verifier
+}
+
+// Key is a single signing key. Keys loaded from a public key only can verify tokens but not sign them.
+type Key struct {
+	id         string
+	method     jwt.SigningMethod
+	signingKey interface{}
+	verifyKey  interface{}
+}
+
+func NewHMACKey(secret string) *Key {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("kid"))
+
+	return &Key{
+		id:         encodeKeyID(mac.Sum(nil)),
+		method:     jwt.SigningMethodHS256,
+		signingKey: []byte(secret),
+		verifyKey:  []byte(secret),
+	}
+}
+
+// NewKey builds a signing key for an asymmetric algorithm from its private key.
+func NewKey(alg string, privateKey crypto.Signer) (*Key, error) {
+	method, err := signingMethod(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkKeyType(alg, privateKey.Public()); err != nil {
+		return nil, err
+	}
+
+	id, err := publicKeyID(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		id:         id,
+		method:     method,
+		signingKey: privateKey,
+		verifyKey:  privateKey.Public(),
+	}, nil
+}
+
+// NewVerificationKey builds a verify-only key for an asymmetric algorithm from its public key.
+func NewVerificationKey(alg string, publicKey crypto.PublicKey) (*Key, error) {
+	method, err := signingMethod(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkKeyType(alg, publicKey); err != nil {
+		return nil, err
+	}
+
+	id, err := publicKeyID(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		id:        id,
+		method:    method,
+		verifyKey: publicKey,
+	}, nil
+}
+
+// LoadPrivateKey reads a PEM encoded private key for the given algorithm.
+func LoadPrivateKey(alg, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var privateKey crypto.Signer
+
+	switch alg {
+	case AlgRS256:
+		privateKey, err = jwt.ParseRSAPrivateKeyFromPEM(data)
+	case AlgES256:
+		privateKey, err = jwt.ParseECPrivateKeyFromPEM(data)
+	case AlgEdDSA:
+		var key crypto.PrivateKey
+		if key, err = jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			edKey, ok := key.(ed25519.PrivateKey)
+			if !ok {
+				return nil, appError.ErrInvalidSigningKey
+			}
+			privateKey = edKey
+		}
+	default:
+		return nil, appError.ErrUnsupportedAlg
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKey(alg, privateKey)
+}
+
+// LoadPublicKey reads a PEM encoded public key for the given algorithm. The result can only verify tokens.
+func LoadPublicKey(alg, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var publicKey crypto.PublicKey
+
+	switch alg {
+	case AlgRS256:
+		publicKey, err = jwt.ParseRSAPublicKeyFromPEM(data)
+	case AlgES256:
+		publicKey, err = jwt.ParseECPublicKeyFromPEM(data)
+	case AlgEdDSA:
+		publicKey, err = jwt.ParseEdPublicKeyFromPEM(data)
+	default:
+		return nil, appError.ErrUnsupportedAlg
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewVerificationKey(alg, publicKey)
+}
+
+// GenerateKey creates a fresh random key for the given algorithm, used for scheduled rotation.
+func GenerateKey(alg string) (*Key, error) {
+	var (
+		privateKey crypto.Signer
+		err        error
+	)
+
+	switch alg {
+	case AlgHS256:
+		secret, err := GenerateRefreshToken(32)
+		if err != nil {
+			return nil, err
+		}
+		return NewHMACKey(secret), nil
+	case AlgRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, appError.ErrUnsupportedAlg
+	}
+	if err != nil {
+		return nil, appError.ErrFailedRandGeneration
+	}
+
+	return NewKey(alg, privateKey)
+}
+
+// KeyID is derived from the key material, so every service loading the same key agrees on it.
+func (k *Key) KeyID() string {
+	return k.id
+}
+
+func (k *Key) Algorithm() string {
+	return k.method.Alg()
+}
+
+// Sign signs claims and sets the kid header. Verify-only keys return ErrMissingSigningKey.
+func (k *Key) Sign(claims jwt.Claims) (string, error) {
+	if k.signingKey == nil {
+		return "", appError.ErrMissingSigningKey
+	}
+
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.id
+	return token.SignedString(k.signingKey)
+}
+
+func (k *Key) VerificationKey(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, appError.ErrInvalidToken
+	}
+	return k.verifyKey, nil
+}
+
+// PublicKey returns the public half of an asymmetric key, or nil for HMAC keys.
+func (k *Key) PublicKey() crypto.PublicKey {
+	if _, ok := k.verifyKey.([]byte); ok {
+		return nil
+	}
+	return k.verifyKey
+}
+
+func publicKeyID(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", appError.ErrInvalidSigningKey
+	}
+	sum := sha256.Sum256(der)
+	return encodeKeyID(sum[:]), nil
+}
+
+func encodeKeyID(sum []byte) string {
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+func signingMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case AlgRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgES256:
+		return jwt.SigningMethodES256, nil
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, appError.ErrUnsupportedAlg
+	}
+}
+
+func checkKeyType(alg string, publicKey crypto.PublicKey) error {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if alg == AlgRS256 && key.N.BitLen() >= 2048 {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if alg == AlgES256 && key.Curve == elliptic.P256() {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if alg == AlgEdDSA {
+			return nil
+		}
+	}
+	return appError.ErrInvalidSigningKey
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	appError "github.com/sanchey92/jwt-example/internal/errors"
+	"github.com/sanchey92/jwt-example/internal/models"
+)
+
+func TestAsymmetricKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		alg        string
+		privateKey crypto.Signer
+	}{
+		{name: "RS256", alg: AlgRS256, privateKey: rsaKey},
+		{name: "ES256", alg: AlgES256, privateKey: ecKey},
+		{name: "EdDSA", alg: AlgEdDSA, privateKey: edKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			privatePath := writePEM(t, dir, "private.pem", "PRIVATE KEY", marshalPKCS8(t, tt.privateKey))
+			publicPath := writePEM(t, dir, "public.pem", "PUBLIC KEY", marshalPKIX(t, tt.privateKey.Public()))
+
+			signer, err := LoadPrivateKey(tt.alg, privatePath)
+			require.NoError(t, err)
+
+			verifier, err := LoadPublicKey(tt.alg, publicPath)
+			require.NoError(t, err)
+
+			user := &models.User{ID: uuid.New(), Roles: []models.Role{models.RoleUser}}
+
+			token, err := GenerateJWTToken(user, testTTL, signer, testOptions)
+			require.NoError(t, err)
+
+			claims, err := ParseToken(token, verifier, testOptions)
+			assert.NoError(t, err)
+			assert.Equal(t, user.ID.String(), claims.Subject)
+
+			_, err = GenerateJWTToken(user, testTTL, verifier, testOptions)
+			assert.ErrorIs(t, err, appError.ErrMissingSigningKey)
+
+			_, err = ParseToken(token, NewHMACKey(testSecret), testOptions)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestHMACTokenRejectedByPublicKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	verifier, err := NewVerificationKey(AlgRS256, rsaKey.Public())
+	require.NoError(t, err)
+
+	token, err := GenerateJWTToken(&models.User{ID: uuid.New()}, testTTL, NewHMACKey(testSecret), testOptions)
+	require.NoError(t, err)
+
+	_, err = ParseToken(token, verifier, testOptions)
+	assert.Error(t, err)
+}
+
+func TestNewKeyAlgorithmMismatch(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	_, err = NewKey(AlgES256, ecKey)
+	assert.ErrorIs(t, err, appError.ErrInvalidSigningKey)
+
+	_, err = NewKey(AlgRS256, ecKey)
+	assert.ErrorIs(t, err, appError.ErrInvalidSigningKey)
+
+	_, err = NewKey("none", ecKey)
+	assert.ErrorIs(t, err, appError.ErrUnsupportedAlg)
+}
+
+func marshalPKCS8(t *testing.T, key crypto.Signer) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return der
+}
+
+func marshalPKIX(t *testing.T, key crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return der
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
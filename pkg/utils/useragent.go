@@ -0,0 +1,52 @@
+package utils
+
+import "strings"
+
+var (
+	browsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"okhttp/", "Android app"},
+		{"CFNetwork/", "iOS app"},
+	}
+
+	platforms = []struct{ token, name string }{
+		{"Windows", "Windows"},
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// DeviceLabel turns a User-Agent header into a short human readable label like "Chrome on macOS".
+func DeviceLabel(userAgent string) string {
+	browser := match(userAgent, browsers)
+	platform := match(userAgent, platforms)
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "Unknown device"
+	}
+}
+
+func match(userAgent string, known []struct{ token, name string }) string {
+	for _, k := range known {
+		if strings.Contains(userAgent, k.token) {
+			return k.name
+		}
+	}
+	return ""
+}
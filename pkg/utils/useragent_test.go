@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceLabel(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want:      "Chrome on macOS",
+		},
+		{
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0",
+			want:      "Edge on Windows",
+		},
+		{
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			want:      "Safari on iOS",
+		},
+		{
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want:      "Firefox on Linux",
+		},
+		{
+			userAgent: "curl/8.4.0",
+			want:      "curl",
+		},
+		{
+			userAgent: "",
+			want:      "Unknown device",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, DeviceLabel(tt.userAgent))
+		})
+	}
+}
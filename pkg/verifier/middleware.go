@@ -0,0 +1,99 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type contextKey struct{}
+
+// Middleware rejects requests without a valid bearer access token and stores the verified
+// claims in the request context. It can be mounted with chi's Router.Use or Group.
+func (v *Verifier) Middleware() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+				writeUnauthorized(w, "unauthorized")
+				return
+			}
+
+			claims, err := v.Verify(r.Context(), strings.TrimPrefix(authHeader, "Bearer "))
+			if err != nil {
+				writeUnauthorized(w, verifyErrorMessage(err))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+		})
+	}
+}
+
+// RequireClient lets through tokens of services authenticated with the client_credentials grant
+// that hold every listed scope, and answers 403 to user tokens. It must run after Middleware.
+func RequireClient(scopes ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				writeUnauthorized(w, "unauthorized")
+				return
+			}
+
+			if !claims.IsClient() {
+				writeForbidden(w, "token was not issued to a client")
+				return
+			}
+
+			for _, scope := range scopes {
+				if !claims.HasScope(scope) {
+					writeForbidden(w, "missing scope "+scope)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by Middleware.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// verifyErrorMessage tells clients why their token was refused without exposing why the key set
+// could not be fetched.
+func verifyErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "token expired"
+	case errors.Is(err, ErrFetchJWKS):
+		return "signing keys are unavailable"
+	default:
+		return "invalid token"
+	}
+}
+
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+func writeForbidden(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
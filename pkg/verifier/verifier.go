@@ -0,0 +1,264 @@
+package verifier
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/sanchey92/jwt-example/pkg/jwk"
+)
+
+var (
+	ErrMissingJWKSURL = errors.New("jwks url is required")
+	ErrUnknownKey     = errors.New("unknown signing key")
+	ErrFetchJWKS      = errors.New("failed to fetch jwks")
+)
+
+const (
+	defaultCacheTTL           = 5 * time.Minute
+	defaultMinRefreshInterval = 30 * time.Second
+	defaultHTTPTimeout        = 5 * time.Second
+	maxJWKSSize               = 1 << 20
+)
+
+type Config struct {
+	JWKSURL  string
+	Issuer   string        // expected iss claim, not checked when empty
+	Audience string        // expected aud claim, not checked when empty
+	Leeway   time.Duration // allowed clock skew for exp, nbf and iat
+
+	CacheTTL           time.Duration // how long a fetched key set is used, 5 minutes by default
+	MinRefreshInterval time.Duration // minimal pause between refetches caused by unknown kid, 30 seconds by default
+	HTTPClient         *http.Client
+}
+
+// Claims are the access token claims issued by the auth service. Tokens of OAuth clients carry
+// ClientID and the space-separated Scope; when the client acts for itself, Subject is the ClientID.
+type Claims struct {
+	// Deprecated: Role is the single role claim of earlier releases, it is dropped in the next
+	// release. Use Roles.
+	Role        string   `json:"role,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IsClient reports whether the token was issued to a service with the client_credentials grant.
+func (c *Claims) IsClient() bool {
+	return c.ClientID != "" && c.Subject == c.ClientID
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier validates access tokens against a remote JWKS document, so consuming services
+// never need the signing secret or a connection to the auth database.
+type Verifier struct {
+	cfg     Config
+	parser  *jwt.Parser
+	fetches singleflight.Group // one fetch at a time, callers arriving meanwhile share its result
+
+	mu          sync.Mutex // guards the fields below, never held during a fetch
+	keys        map[string]verificationKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+type verificationKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+func New(cfg Config) (*Verifier, error) {
+	if cfg.JWKSURL == "" {
+		return nil, ErrMissingJWKSURL
+	}
+
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = defaultCacheTTL
+	}
+
+	if cfg.MinRefreshInterval <= 0 {
+		cfg.MinRefreshInterval = defaultMinRefreshInterval
+	}
+
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+
+	return &Verifier{
+		cfg:    cfg,
+		parser: jwt.NewParser(opts...),
+	}, nil
+}
+
+// Verify checks the token signature and its iss, aud, exp and nbf claims.
+func (v *Verifier) Verify(ctx context.Context, tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+
+	_, err := v.parser.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := v.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if key.alg != "" && key.alg != token.Method.Alg() {
+			return nil, ErrUnknownKey
+		}
+
+		return key.key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// Refresh fetches the key set regardless of the cache state.
+func (v *Verifier) Refresh(ctx context.Context) error {
+	return v.fetchShared(ctx, false)
+}
+
+func (v *Verifier) key(ctx context.Context, kid string) (verificationKey, error) {
+	keys, fetchedAt := v.cached()
+
+	if keys == nil || time.Since(fetchedAt) > v.cfg.CacheTTL {
+		// A stale key set is still better than none while the auth service is unreachable.
+		if err := v.fetchShared(ctx, true); err != nil && keys == nil {
+			return verificationKey{}, err
+		}
+		keys, _ = v.cached()
+	}
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	// The key was probably rotated after our last fetch.
+	if err := v.fetchShared(ctx, true); err != nil {
+		return verificationKey{}, ErrUnknownKey
+	}
+
+	keys, _ = v.cached()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	return verificationKey{}, ErrUnknownKey
+}
+
+func (v *Verifier) cached() (map[string]verificationKey, time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.keys, v.fetchedAt
+}
+
+// fetchShared fetches the key set once for all concurrent callers. Throttled fetches are limited
+// to one per MinRefreshInterval, so tokens with unknown kid values cannot make us flood the auth
+// service. The fetch outlives a caller that gives up, the others still wait for it.
+func (v *Verifier) fetchShared(ctx context.Context, throttled bool) error {
+	key := "refresh"
+	if throttled {
+		key = "refetch"
+	}
+
+	result := v.fetches.DoChan(key, func() (interface{}, error) {
+		v.mu.Lock()
+		if throttled && time.Since(v.attemptedAt) < v.cfg.MinRefreshInterval {
+			v.mu.Unlock()
+			return nil, ErrFetchJWKS
+		}
+		v.attemptedAt = time.Now()
+		v.mu.Unlock()
+
+		return nil, v.fetch(context.WithoutCancel(ctx))
+	})
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", ErrFetchJWKS, ctx.Err())
+	case res := <-result:
+		return res.Err
+	}
+}
+
+func (v *Verifier) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.JWKSURL, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFetchJWKS, err)
+	}
+
+	resp, err := v.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFetchJWKS, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: unexpected status %d", ErrFetchJWKS, resp.StatusCode)
+	}
+
+	var set jwk.Set
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&set); err != nil {
+		return fmt.Errorf("%w: %w", ErrFetchJWKS, err)
+	}
+
+	keys := make(map[string]verificationKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		publicKey, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+
+		keys[k.Kid] = verificationKey{alg: k.Alg, key: publicKey}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.keys = keys
+	v.fetchedAt = time.Now()
+
+	return nil
+}
@@ -0,0 +1,290 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sanchey92/jwt-example/pkg/utils"
+)
+
+const (
+	testIssuer   = "https://auth.example.com"
+	testAudience = "api"
+)
+
+func newTestServer(t *testing.T, ring *utils.KeyRing) (*httptest.Server, *int32) {
+	var fetches int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		set, err := ring.JWKS()
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &fetches
+}
+
+func signClaims(t *testing.T, signer utils.Signer, mutate func(c *Claims)) string {
+	now := time.Now()
+	claims := &Claims{
+		Roles: []string{"user"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   uuid.New().String(),
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+	if mutate != nil {
+		mutate(claims)
+	}
+
+	token, err := signer.Sign(claims)
+	require.NoError(t, err)
+	return token
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	key, err := utils.GenerateKey(utils.AlgES256)
+	require.NoError(t, err)
+	ring := utils.NewKeyRing(key)
+
+	srv, _ := newTestServer(t, ring)
+
+	v, err := New(Config{JWKSURL: srv.URL, Issuer: testIssuer, Audience: testAudience})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "valid token",
+			token: signClaims(t, ring, nil),
+		},
+		{
+			name:    "expired token",
+			token:   signClaims(t, ring, func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }),
+			wantErr: true,
+		},
+		{
+			name:    "not yet valid",
+			token:   signClaims(t, ring, func(c *Claims) { c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute)) }),
+			wantErr: true,
+		},
+		{
+			name:    "wrong issuer",
+			token:   signClaims(t, ring, func(c *Claims) { c.Issuer = "https://evil.example.com" }),
+			wantErr: true,
+		},
+		{
+			name:    "wrong audience",
+			token:   signClaims(t, ring, func(c *Claims) { c.Audience = jwt.ClaimStrings{"other"} }),
+			wantErr: true,
+		},
+		{
+			name:    "hmac token",
+			token:   signClaims(t, utils.NewHMACKey("secret"), nil),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(context.Background(), tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"user"}, claims.Roles)
+		})
+	}
+}
+
+func TestVerifier_RefreshOnUnknownKeyID(t *testing.T) {
+	first, err := utils.GenerateKey(utils.AlgEdDSA)
+	require.NoError(t, err)
+	second, err := utils.GenerateKey(utils.AlgEdDSA)
+	require.NoError(t, err)
+
+	ring := utils.NewKeyRing(first)
+	srv, fetches := newTestServer(t, ring)
+
+	v, err := New(Config{JWKSURL: srv.URL, MinRefreshInterval: time.Nanosecond})
+	require.NoError(t, err)
+
+	_, err = v.Verify(context.Background(), signClaims(t, ring, nil))
+	require.NoError(t, err)
+	_, err = v.Verify(context.Background(), signClaims(t, ring, nil))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(fetches), "key set must be cached")
+
+	ring.Schedule([]utils.ScheduledKey{{Key: second, ActivatesAt: time.Now()}}, time.Hour, time.Now())
+
+	_, err = v.Verify(context.Background(), signClaims(t, ring, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(fetches))
+}
+
+func TestVerifier_FetchOutsideLock(t *testing.T) {
+	first, err := utils.GenerateKey(utils.AlgEdDSA)
+	require.NoError(t, err)
+	second, err := utils.GenerateKey(utils.AlgEdDSA)
+	require.NoError(t, err)
+
+	ring := utils.NewKeyRing(first)
+	knownToken := signClaims(t, ring, nil)
+
+	var fetches int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-release
+		}
+		set, err := ring.JWKS()
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(srv.Close)
+
+	v, err := New(Config{JWKSURL: srv.URL, MinRefreshInterval: time.Nanosecond})
+	require.NoError(t, err)
+
+	_, err = v.Verify(context.Background(), knownToken)
+	require.NoError(t, err)
+
+	ring.Schedule([]utils.ScheduledKey{{Key: second, ActivatesAt: time.Now()}}, time.Hour, time.Now())
+	rotatedToken := signClaims(t, ring, nil)
+
+	done := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := v.Verify(context.Background(), rotatedToken)
+			done <- err
+		}()
+	}
+
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&fetches) == 2 }, time.Second, time.Millisecond)
+
+	verified := make(chan error, 1)
+	go func() {
+		_, err := v.Verify(context.Background(), knownToken)
+		verified <- err
+	}()
+
+	select {
+	case err = <-verified:
+		assert.NoError(t, err, "cached keys must verify while a fetch is pending")
+	case <-time.After(time.Second):
+		t.Fatal("verification blocked by a pending fetch")
+	}
+
+	close(release)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, <-done)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches), "concurrent callers must share one fetch")
+}
+
+func TestVerifier_MiddlewareHidesFetchError(t *testing.T) {
+	key, err := utils.GenerateKey(utils.AlgRS256)
+	require.NoError(t, err)
+
+	v, err := New(Config{JWKSURL: "http://127.0.0.1:1/internal-jwks"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signClaims(t, utils.NewKeyRing(key), nil))
+	rec := httptest.NewRecorder()
+	v.Middleware()(http.NotFoundHandler()).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "127.0.0.1")
+}
+
+func TestVerifier_Middleware(t *testing.T) {
+	key, err := utils.GenerateKey(utils.AlgRS256)
+	require.NoError(t, err)
+	ring := utils.NewKeyRing(key)
+	srv, _ := newTestServer(t, ring)
+
+	v, err := New(Config{JWKSURL: srv.URL})
+	require.NoError(t, err)
+
+	handler := v.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		require.True(t, ok)
+		w.Write([]byte(claims.Subject))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signClaims(t, ring, nil))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEmpty(t, rec.Body.String())
+}
+
+func TestRequireClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     *Claims
+		wantStatus int
+	}{
+		{
+			name:       "client token",
+			claims:     &Claims{ClientID: "batch", Scope: "reports:read reports:write", RegisteredClaims: jwt.RegisteredClaims{Subject: "batch"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "scope missing",
+			claims:     &Claims{ClientID: "batch", Scope: "reports:write", RegisteredClaims: jwt.RegisteredClaims{Subject: "batch"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "user token",
+			claims:     &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "5a4d9c1e-6b0e-4a47-9f5b-1f0d5c0e8f11"}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "no token",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireClient("reports:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.claims != nil {
+				req = req.WithContext(NewContext(req.Context(), tt.claims))
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}